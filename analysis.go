@@ -3,32 +3,48 @@ package main
 import (
 	"errors"
 	"fmt"
-	"go/build"
 	"go/types"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/ofabry/go-callvis/internal/pointer"
+	"golang.org/x/tools/go/callgraph"
 	"golang.org/x/tools/go/packages"
-	"golang.org/x/tools/go/pointer"
 	"golang.org/x/tools/go/ssa"
 	"golang.org/x/tools/go/ssa/ssautil"
 )
 
 //==[ type def/func: analysis   ]===============================================
 type renderOpts struct {
-	cacheDir string
-	focus    string
-	group    []string
-	ignore   []string
-	include  []string
-	limit    []string
-	nointer  bool
-	refresh  bool
-	nostd    bool
+	cacheDir  string
+	focus     string
+	group     []string
+	ignore    []string
+	include   []string
+	limit     []string
+	cignore   []string
+	collapse  string
+	callsites string
+	generics  string
+	testrun   string
+	expand    []string
+	query     url.Values // request of web UI, nil for static output
+	nointer   bool
+	dispatch  bool
+	embedding bool
+	funcs     bool
+	conc      bool
+	hidecov   bool
+	hidecold  bool
+	srcurl    string
+	refresh   bool
+	nostd     bool
+	noclib    bool
 }
 
 // mainPackages returns the main packages to analyze.
@@ -46,43 +62,71 @@ func mainPackages(pkgs []*ssa.Package) ([]*ssa.Package, error) {
 	return mains, nil
 }
 
+// analysisViews are the views DoAnalysis prepares the pointer queries of,
+// which cannot be added once the analysis ran.
+type analysisViews struct {
+	funcs bool // see -funcs
+	conc  bool // see -concurrency
+}
+
 //==[ type def/func: analysis   ]===============================================
 type analysis struct {
-	opts   *renderOpts
-	prog   *ssa.Program
-	pkgs   []*ssa.Package
-	mains  []*ssa.Package
-	result *pointer.Result
+	opts     *renderOpts
+	prog     *ssa.Program
+	pkgs     []*ssa.Package
+	mains    []*ssa.Package
+	tests    bool
+	modules  map[string]*pkgModule
+	promoted *promotions
+	flows    []funcFlow
+	conc     *concurrency
+	coverage *coverage
+	profile  *pprofData
+	trace    *callTrace
+	matrix   *buildMatrix
+	sources  map[string]bool
+	result   *pointer.Result
 }
 
 var Analysis *analysis
 
-func (a *analysis) DoAnalysis(
+// loadProgram loads the packages of args in the build configuration bc and
+// builds their SSA program.
+func loadProgram(
+	bc *buildConfig,
 	dir string,
 	tests bool,
 	args []string,
-) error {
-	cfg := &packages.Config{
-		Mode:       packages.LoadAllSyntax,
-		Tests:      tests,
-		Dir:        dir,
-		BuildFlags: build.Default.BuildTags,
-	}
-
-	initial, err := packages.Load(cfg, args...)
+) ([]*packages.Package, *ssa.Program, []*ssa.Package, []*ssa.Package, error) {
+	initial, err := packages.Load(bc.packagesConfig(dir, tests), args...)
 	if err != nil {
-		return err
+		return nil, nil, nil, nil, err
 	}
 
 	if packages.PrintErrors(initial) > 0 {
-		return fmt.Errorf("packages contain errors")
+		return nil, nil, nil, nil, fmt.Errorf("packages contain errors")
 	}
 
-	// Create and build SSA-form program representation.
-	prog, pkgs := ssautil.AllPackages(initial, 0)
+	// Create and build SSA-form program representation, with a function
+	// per instantiation of generic functions as pointer analysis requires.
+	prog, pkgs := ssautil.AllPackages(initial, ssa.InstantiateGenerics)
 	prog.Build()
 
 	mains, err := mainPackages(pkgs)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return initial, prog, pkgs, mains, nil
+}
+
+func (a *analysis) DoAnalysis(
+	bc *buildConfig,
+	dir string,
+	tests bool,
+	views analysisViews,
+	args []string,
+) error {
+	initial, prog, pkgs, mains, err := loadProgram(bc, dir, tests, args)
 	if err != nil {
 		return err
 	}
@@ -91,6 +135,18 @@ func (a *analysis) DoAnalysis(
 		Mains:          mains,
 		BuildCallGraph: true,
 	}
+	var funcs map[*ssa.Function]bool
+	if views.funcs || views.conc {
+		funcs = ssautil.AllFunctions(prog)
+	}
+	var sites []ssa.CallInstruction
+	if views.funcs {
+		sites = addFuncValueQueries(funcs, config)
+	}
+	var conc *concurrency
+	if views.conc {
+		conc = addChanQueries(funcs, config)
+	}
 
 	result, err := pointer.Analyze(config)
 	if err != nil {
@@ -98,23 +154,114 @@ func (a *analysis) DoAnalysis(
 	}
 	//cg.DeleteSyntheticNodes()
 
+	// C code may call back into Go through //export functions
+	addCGOExportEdges(prog, result.CallGraph)
+
+	// before rendering deletes the promotion wrappers from the call graph
+	a.promoted = findPromotions(initial, result.CallGraph)
+	if views.funcs {
+		a.flows = funcFlows(prog, funcs, sites, result)
+	}
+	if views.conc {
+		conc.resolve(result)
+		a.conc = conc
+	}
+
 	a.prog = prog
 	a.pkgs = pkgs
 	a.mains = mains
+	a.tests = tests
+	a.modules = packageModules(initial)
+	a.sources = sourceFiles(prog)
 	a.result = result
 	return nil
 }
 
+// LoadCoverage reads the coverage profile at path to color the functions
+// by their test coverage.
+func (a *analysis) LoadCoverage(path string) error {
+	cov, err := readCoverProfile(path)
+	if err != nil {
+		return err
+	}
+	a.coverage = cov
+	return nil
+}
+
+// LoadProfile reads the pprof profile at path to weight the functions and
+// calls by their cost.
+func (a *analysis) LoadProfile(path string) error {
+	prof, err := readPprof(a.prog, path)
+	if err != nil {
+		return err
+	}
+	if prof.unmapped > 0 {
+		logf("%d functions of the profile not found in the program", prof.unmapped)
+	}
+	a.profile = prof
+	return nil
+}
+
+// LoadCallTrace reads the calls observed at runtime at path to validate the
+// dynamic calls of the graph.
+func (a *analysis) LoadCallTrace(path string) error {
+	trace, err := readCallTrace(a.prog, path)
+	if err != nil {
+		return err
+	}
+	if trace.unmapped > 0 {
+		logf("%d functions of the call trace not found in the program", trace.unmapped)
+	}
+	a.trace = trace
+	return nil
+}
+
+// LoadMatrix analyzes the packages of args in the build configurations
+// after the first one, the one of the analysis, to mark the calls made in
+// some configurations only.
+func (a *analysis) LoadMatrix(configs []*buildConfig, dir string, tests bool, args []string) error {
+	matrix := &buildMatrix{
+		configs: configs,
+		calls:   make(map[[2]string][]string),
+		funcs:   make(map[string][]string),
+		edges:   make(map[[2]string]*callgraph.Edge),
+	}
+	matrix.add(configs[0], a.result.CallGraph)
+	for _, bc := range configs[1:] {
+		logf("analyzing build configuration %s", bc.Name)
+		cg, err := analyzeCallGraph(bc, dir, tests, args)
+		if err != nil {
+			return fmt.Errorf("build configuration %s: %v", bc.Name, err)
+		}
+		matrix.add(bc, cg)
+	}
+	a.matrix = matrix
+	return nil
+}
+
 func (a *analysis) OptsSetup() {
 	a.opts = &renderOpts{
-		cacheDir: *cacheDir,
-		focus:    *focusFlag,
-		group:    []string{*groupFlag},
-		ignore:   []string{*ignoreFlag},
-		include:  []string{*includeFlag},
-		limit:    []string{*limitFlag},
-		nointer:  *nointerFlag,
-		nostd:    *nostdFlag,
+		cacheDir:  *cacheDir,
+		focus:     *focusFlag,
+		group:     []string{*groupFlag},
+		ignore:    []string{*ignoreFlag},
+		include:   []string{*includeFlag},
+		limit:     []string{*limitFlag},
+		cignore:   []string{*cignoreFlag},
+		collapse:  *collapseFlag,
+		callsites: *callsitesFlag,
+		generics:  *genericsFlag,
+		testrun:   *testRunFlag,
+		nointer:   *nointerFlag,
+		nostd:     *nostdFlag,
+		noclib:    *noclibFlag,
+		dispatch:  *dispatchFlag,
+		embedding: *embeddingFlag,
+		funcs:     *funcsFlag,
+		conc:      *concFlag,
+		hidecov:   *hidecovFlag,
+		hidecold:  *hidecoldFlag,
+		srcurl:    *srcurlFlag,
 	}
 }
 
@@ -123,13 +270,16 @@ func (a *analysis) ProcessListArgs() (e error) {
 	var ignorePaths []string
 	var includePaths []string
 	var limitPaths []string
+	var cignorePatterns []string
 
 	for _, g := range strings.Split(a.opts.group[0], ",") {
 		g := strings.TrimSpace(g)
 		if g == "" {
 			continue
 		}
-		if g != "pkg" && g != "type" {
+		switch g {
+		case "pkg", "type", "module", "dir", "file":
+		default:
 			e = errors.New("invalid group option")
 			return
 		}
@@ -157,10 +307,45 @@ func (a *analysis) ProcessListArgs() (e error) {
 		}
 	}
 
+	for _, p := range strings.Split(a.opts.cignore[0], ",") {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			cignorePatterns = append(cignorePatterns, p)
+		}
+	}
+
+	if a.opts.collapse != "" && a.opts.collapse != "pkg" && a.opts.collapse != "type" {
+		e = errors.New("invalid collapse option")
+		return
+	}
+
+	switch a.opts.callsites {
+	case "merge", "count", "each":
+	default:
+		e = errors.New("invalid callsites option")
+		return
+	}
+
+	if a.opts.generics != "inst" && a.opts.generics != "decl" {
+		e = errors.New("invalid generics option")
+		return
+	}
+
+	var expandKeys []string
+	for _, k := range a.opts.expand {
+		for _, k := range strings.Split(k, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				expandKeys = append(expandKeys, k)
+			}
+		}
+	}
+
 	a.opts.group = groupBy
 	a.opts.ignore = ignorePaths
 	a.opts.include = includePaths
 	a.opts.limit = limitPaths
+	a.opts.cignore = cignorePatterns
+	a.opts.expand = expandKeys
 
 	return
 }
@@ -174,9 +359,30 @@ func (a *analysis) OverrideByHTTP(r *http.Request) {
 	if std := r.FormValue("std"); std != "" {
 		a.opts.nostd = false
 	}
+	if clib := r.FormValue("clib"); clib != "" {
+		a.opts.noclib = false
+	}
 	if inter := r.FormValue("nointer"); inter != "" {
 		a.opts.nointer = true
 	}
+	if d := r.FormValue("dispatch"); d != "" {
+		a.opts.dispatch = d != "0" && d != "false"
+	}
+	if e := r.FormValue("embedding"); e != "" {
+		a.opts.embedding = e != "0" && e != "false"
+	}
+	if f := r.FormValue("funcs"); f != "" {
+		a.opts.funcs = f != "0" && f != "false"
+	}
+	if c := r.FormValue("concurrency"); c != "" {
+		a.opts.conc = c != "0" && c != "false"
+	}
+	if h := r.FormValue("hidecovered"); h != "" {
+		a.opts.hidecov = h != "0" && h != "false"
+	}
+	if h := r.FormValue("hideunsampled"); h != "" {
+		a.opts.hidecold = h != "0" && h != "false"
+	}
 	if refresh := r.FormValue("refresh"); refresh != "" {
 		a.opts.refresh = true
 	}
@@ -192,12 +398,33 @@ func (a *analysis) OverrideByHTTP(r *http.Request) {
 	if inc := r.FormValue("include"); inc != "" {
 		a.opts.include[0] = inc
 	}
+	if cign := r.FormValue("cignore"); cign != "" {
+		a.opts.cignore[0] = cign
+	}
+	if c := r.FormValue("collapse"); c == "none" {
+		a.opts.collapse = ""
+	} else if c != "" {
+		a.opts.collapse = c
+	}
+	if exp := r.FormValue("expand"); exp != "" {
+		a.opts.expand = []string{exp}
+	}
+	if cs := r.FormValue("callsites"); cs != "" {
+		a.opts.callsites = cs
+	}
+	if gen := r.FormValue("generics"); gen != "" {
+		a.opts.generics = gen
+	}
+	if run := r.FormValue("test-run"); run != "" {
+		a.opts.testrun = run
+	}
+	a.opts.query = r.URL.Query()
 	return
 }
 
 // basically do printOutput() with previously checking
 // focus option and respective package
-func (a *analysis) Render() ([]byte, error) {
+func (a *analysis) Render() (*dotGraph, error) {
 	var (
 		err      error
 		ssaPkg   *ssa.Package
@@ -233,7 +460,42 @@ func (a *analysis) Render() ([]byte, error) {
 		logf("focusing: %v", focusPkg.Path())
 	}
 
-	dot, err := printOutput(
+	opts := &outputOpts{
+		modules:         a.modules,
+		cignorePatterns: a.opts.cignore,
+		noclib:          a.opts.noclib,
+		dispatch:        a.opts.dispatch,
+		cov:             a.coverage,
+		hideCovered:     a.opts.hidecov && a.coverage != nil,
+		prof:            a.profile,
+		hideUnsampled:   a.opts.hidecold && a.profile != nil,
+		trace:           a.trace,
+		callSites:       a.opts.callsites,
+		generics:        a.opts.generics,
+		matrix:          a.matrix,
+	}
+	if a.opts.embedding {
+		opts.promoted = a.promoted
+	}
+	if a.opts.funcs {
+		opts.flows = a.flows
+	}
+	if a.opts.conc {
+		opts.conc = a.conc
+	}
+	if a.tests {
+		roots, err := testRoots(a.prog, a.pkgs, a.opts.testrun)
+		if err != nil {
+			return nil, err
+		}
+		logf("%d test roots", len(roots))
+		opts.tested = testReach(a.result.CallGraph, roots)
+		if opts.matrix != nil {
+			opts.matrix.reach(opts.tested)
+		}
+	}
+
+	dotg, err := printOutput(
 		a.prog,
 		a.mains[0].Pkg,
 		a.result.CallGraph,
@@ -244,12 +506,44 @@ func (a *analysis) Render() ([]byte, error) {
 		a.opts.group,
 		a.opts.nostd,
 		a.opts.nointer,
+		opts,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("processing failed: %v", err)
 	}
 
-	return dot, nil
+	if a.opts.collapse != "" {
+		var urlFor func(key string) string
+		if a.opts.query != nil {
+			// expand in place, keeping the other parameters
+			urlFor = func(key string) string {
+				q := url.Values{}
+				for k, v := range a.opts.query {
+					q[k] = v
+				}
+				q.Set("collapse", a.opts.collapse)
+				q.Set("expand", strings.Join(append(append([]string{}, a.opts.expand...), key), ","))
+				return "/?" + q.Encode()
+			}
+		}
+		dotg = collapseGraph(dotg, a.opts.collapse, a.opts.expand, urlFor)
+	}
+
+	// link nodes and edges to their source
+	if a.opts.srcurl != "" {
+		linkSources(dotg, func(file string, line int) string {
+			return templateURL(a.opts.srcurl, file, line)
+		})
+	} else if a.opts.query != nil {
+		linkSources(dotg, func(file string, line int) string {
+			if !a.sources[file] {
+				return ""
+			}
+			return viewerURL(file, line)
+		})
+	}
+
+	return dotg, nil
 }
 
 func (a *analysis) FindCachedImg() string {
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"regexp"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// maxCallExpr is the length at which call expressions are cut.
+const maxCallExpr = 60
+
+// lineBreak matches a line break of a call expression spanning several
+// lines and the indentation around it.
+var lineBreak = regexp.MustCompile(`[ \t]*\r?\n\s*`)
+
+// callExprs holds the source text of the call expressions of functions by
+// the position of their call instructions, taken from the source files of
+// the functions on first use.
+type callExprs struct {
+	exprs map[*ssa.Function]map[token.Pos]string
+	files map[string][]byte // contents of the source files, nil if unreadable
+}
+
+// source returns the source text of n in fset, with its line breaks
+// replaced by spaces, or its syntax printed by go/types if the file cannot
+// be read.
+func (c *callExprs) source(fset *token.FileSet, n ast.Node) string {
+	start := fset.PositionFor(n.Pos(), false)
+	end := fset.PositionFor(n.End(), false)
+	src, ok := c.files[start.Filename]
+	if !ok {
+		src, _ = os.ReadFile(start.Filename)
+		c.files[start.Filename] = src
+	}
+	if start.Filename != end.Filename || start.Offset > end.Offset || end.Offset > len(src) {
+		switch n := n.(type) {
+		case *ast.GoStmt:
+			return "go " + types.ExprString(n.Call)
+		case *ast.DeferStmt:
+			return "defer " + types.ExprString(n.Call)
+		}
+		return types.ExprString(n.(ast.Expr))
+	}
+	return lineBreak.ReplaceAllString(string(src[start.Offset:end.Offset]), " ")
+}
+
+// text returns the call expression of site, e.g. s.store.Put(ctx, key),
+// or "" if site has no call in the syntax of its function.
+func (c *callExprs) text(site ssa.CallInstruction) string {
+	if site == nil {
+		return ""
+	}
+	if c.exprs == nil {
+		c.exprs = make(map[*ssa.Function]map[token.Pos]string)
+		c.files = make(map[string][]byte)
+	}
+	fn := site.Parent()
+	exprs, ok := c.exprs[fn]
+	if !ok {
+		exprs = make(map[token.Pos]string)
+		if syntax := fn.Syntax(); syntax != nil {
+			fset := fn.Prog.Fset
+			ast.Inspect(syntax, func(n ast.Node) bool {
+				// positions of ssa.Call, ssa.Go and ssa.Defer
+				switch n := n.(type) {
+				case *ast.CallExpr:
+					exprs[n.Lparen] = c.source(fset, n)
+				case *ast.GoStmt:
+					exprs[n.Go] = c.source(fset, n)
+				case *ast.DeferStmt:
+					exprs[n.Defer] = c.source(fset, n)
+				}
+				return true
+			})
+		}
+		c.exprs[fn] = exprs
+	}
+	text := exprs[site.Pos()]
+	if r := []rune(text); len(r) > maxCallExpr {
+		text = string(r[:maxCallExpr-1]) + "…"
+	}
+	return text
+}
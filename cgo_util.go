@@ -2,17 +2,30 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"go/parser"
+	"go/token"
+	"go/types"
 	"io/fs"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/goccy/go-graphviz"
 	"github.com/goccy/go-graphviz/cgraph"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/callgraph/cha"
 	"golang.org/x/tools/go/ssa"
 	"golang.org/x/tools/go/ssa/ssautil"
 )
@@ -21,185 +34,502 @@ const buildPathStr = "build"
 
 var fp, _ = filepath.Abs(*c_root_path)
 var absBuildPath = fp + "/" + buildPathStr
+var absObjPath = absBuildPath + "/_obj"
 var absDefaultDotPath = fp + "/callgraph.dot"
+var absDefaultLLPath = fp + "/tmp.ll"
 
 ///MYCODE
-//	generate c's dot format callgraph
-func genCdotCallgraph(prog *ssa.Program) error {
+//	a failed command of the cgo pipeline
+type cgoFailure struct {
+	File   string
+	Cmd    string
+	Status string
+	Stderr string
+}
+
+///MYCODE
+//	failures collected during one run of the cgo pipeline
+type cgoReport struct {
+	mu       sync.Mutex
+	failures []cgoFailure
+}
+
+var cgoFailures = &cgoReport{}
+
+func (r *cgoReport) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures = nil
+}
+
+func (r *cgoReport) add(f cgoFailure) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures = append(r.failures, f)
+}
+
+func (r *cgoReport) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.failures)
+}
+
+///MYCODE
+//	one line warning for partial C graph, "" if nothing failed
+func (r *cgoReport) Warning() string {
+	if n := r.Len(); n > 0 {
+		return fmt.Sprintf("C call graph is partial: %d cgo step(s) failed, see log for details", n)
+	}
+	return ""
+}
+
+///MYCODE
+//	summary of every failed file with command, exit status and stderr excerpt
+func (r *cgoReport) Summary() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.failures) == 0 {
+		return ""
+	}
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "cgo: %d step(s) failed, C call graph is partial:\n", len(r.failures))
+	for _, f := range r.failures {
+		fmt.Fprintf(&buf, "  %s: %s\n", f.File, f.Status)
+		fmt.Fprintf(&buf, "    command: %s\n", f.Cmd)
+		for _, line := range strings.Split(f.Stderr, "\n") {
+			fmt.Fprintf(&buf, "    | %s\n", line)
+		}
+	}
+	return buf.String()
+}
+
+///MYCODE
+//	run cmd of cgo pipeline for file, record failure if cmd fails.
+func runCgoCmd(file string, cmd *exec.Cmd) error {
+	logf("%s", cmd.String())
+	var stderr bytes.Buffer
+	cmd.Stdout = &stderr
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err == nil {
+		logf("succeed")
+		return nil
+	}
+	logf("%s", stderr.String())
+	excerpt := strings.TrimSpace(stderr.String())
+	if lines := strings.Split(excerpt, "\n"); len(lines) > 5 {
+		excerpt = strings.Join(append(lines[:5], "..."), "\n")
+	}
+	cgoFailures.add(cgoFailure{
+		File:   file,
+		Cmd:    cmd.String(),
+		Status: err.Error(),
+		Stderr: excerpt,
+	})
+	return err
+}
+
+///MYCODE
+//	C macro configuration analysed by the cgo pipeline and its outputs
+type cConfig struct {
+	Name    string
+	Macros  []string // -D/-U options passed to clang
+	build   string   // dir of bitcode files
+	llPath  string   // linked LLVM IR
+	dotPath string   // dot callgraph
+}
+
+///MYCODE
+//	parse -cconfig values like linux=-DLINUX,-UWIN, -cmacro symbols are
+//	shared by all configurations. without -cconfig a single unnamed
+//	configuration is analysed
+func getCConfigs() ([]*cConfig, error) {
+	for _, m := range CMacros {
+		if !strings.HasPrefix(m, "-D") && !strings.HasPrefix(m, "-U") {
+			return nil, fmt.Errorf("invalid C macro %q, want -Dname[=value] or -Uname", m)
+		}
+	}
+	if len(CConfigs) == 0 {
+		return []*cConfig{{
+			Macros:  CMacros,
+			build:   absBuildPath,
+			llPath:  absDefaultLLPath,
+			dotPath: absDefaultDotPath,
+		}}, nil
+	}
+	var configs []*cConfig
+	for _, v := range CConfigs {
+		parts := strings.SplitN(v, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if name == "" || strings.ContainsAny(name, "/\\") {
+			return nil, fmt.Errorf("invalid C configuration %q, want name=-DA,-UB", v)
+		}
+		macros := append([]string{}, CMacros...)
+		if len(parts) == 2 {
+			for _, m := range strings.Split(parts[1], ",") {
+				m = strings.TrimSpace(m)
+				if m == "" {
+					continue
+				}
+				if !strings.HasPrefix(m, "-D") && !strings.HasPrefix(m, "-U") {
+					return nil, fmt.Errorf("invalid C macro %q in configuration %s", m, name)
+				}
+				macros = append(macros, m)
+			}
+		}
+		build := absBuildPath + "-" + name
+		configs = append(configs, &cConfig{
+			Name:    name,
+			Macros:  macros,
+			build:   build,
+			llPath:  build + "/tmp.ll",
+			dotPath: build + "/callgraph.dot",
+		})
+	}
+	return configs, nil
+}
+
+///MYCODE
+//	generate c's dot format callgraph for every macro configuration and
+//	return the ones it was generated for.
+//	in -cgo-strict mode any failed file fails the run
+func genCdotCallgraph(prog *ssa.Program) ([]*cConfig, error) {
+	cgoFailures.reset()
 	if _, err := os.Stat(*c_root_path); err == nil {
+		configs, err := getCConfigs()
+		if err != nil {
+			return nil, err
+		}
 		if err := genObjDir(); err != nil {
 			logf("gen obj dir error")
-			return err
+			return nil, err
 		}
-		if err := genUnifDefAndBitCode(); err != nil {
-			logf("gen unifdef and bitcode error")
-			return err
+		var built []*cConfig
+		for _, cfg := range configs {
+			changed, err := genBitCode(cfg)
+			if err != nil {
+				logf("gen bitcode error")
+				return nil, err
+			}
+			if err := bc2dot(cfg, changed); err != nil {
+				// recorded by runCgoCmd, the configuration has no C graph
+				logf("gen callgraph error")
+				os.Remove(cfg.llPath)
+				os.Remove(cfg.dotPath)
+				continue
+			}
+			built = append(built, cfg)
 		}
-		if err := bc2dot(); err != nil {
-			logf("gen callgraph error")
-			return err
+		if *cgoStrictFlag && cgoFailures.Len() > 0 {
+			return nil, fmt.Errorf("cgo-strict: %s", cgoFailures.Summary())
 		}
-		return nil
+		return built, nil
 	} else {
 		fmt.Printf("%s does not exist\n", *c_root_path)
-		return err
+		return nil, err
 	}
 }
 
 ///MYCODE
-//	generate _obj dir for each package(dir)
+//	generate _obj dir for each package(dir) under build/_obj/, the source
+//	tree is never written to
 func genObjDir() error {
-	gen_obj_args := []string{"tool", "cgo"}
+	if err := os.RemoveAll(absObjPath); err != nil {
+		return err
+	}
+	root, _ := filepath.Abs(*c_root_path)
 	gen_obj_under_dir_fn := func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
 		if !d.IsDir() || strings.Contains(path, "_obj") || strings.Contains(path, "build") {
 			return nil
 		}
 		abs_path, _ := filepath.Abs(path)
-		rds, _ := ioutil.ReadDir(abs_path)
+		rds, err := ioutil.ReadDir(abs_path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, abs_path)
+		if err != nil {
+			return err
+		}
+		obj_dir := filepath.Join(absObjPath, rel)
 		for _, fi := range rds {
-			if !fi.IsDir() && strings.HasSuffix(fi.Name(), ".go") {
-				tmp_args := append(gen_obj_args, abs_path+"/"+fi.Name())
+			if !fi.IsDir() && strings.HasSuffix(fi.Name(), ".go") && importsC(abs_path+"/"+fi.Name()) {
+				tmp_args := []string{"tool", "cgo", "-objdir", obj_dir, abs_path + "/" + fi.Name()}
 				gen_obj_cmd := exec.Command("go", tmp_args...)
 				gen_obj_cmd.Dir = abs_path
-				logf(gen_obj_cmd.String())
-				if b, err := gen_obj_cmd.CombinedOutput(); err != nil {
-					logf(string(b))
-					return nil
-				} else {
-					logf("succeed")
-				}
+				// failure is recorded, go on with other files
+				runCgoCmd(abs_path+"/"+fi.Name(), gen_obj_cmd)
 			}
 		}
 		return nil
 	}
-	filepath.WalkDir(*c_root_path, gen_obj_under_dir_fn)
-	return nil
+	return filepath.WalkDir(*c_root_path, gen_obj_under_dir_fn)
 }
 
 ///MYCODE
-//	use unifdef to trim macros
-func genUnifDefAndBitCode() error {
-	if _, err := os.Lstat(absBuildPath); err == nil {
-		os.RemoveAll(absBuildPath)
+//	report whether Go file imports "C"
+func importsC(path string) bool {
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.ImportsOnly)
+	if err != nil {
+		return false
 	}
-	os.Mkdir(absBuildPath, 0755)
-	gen_unifdef_bc_fn := func(path string, d fs.DirEntry, err error) error {
-		if !d.IsDir() || strings.Contains(path, "build") {
-			return nil
+	for _, imp := range f.Imports {
+		if imp.Path.Value == `"C"` {
+			return true
+		}
+	}
+	return false
+}
+
+///MYCODE
+//	a C file to be compiled to bitcode in build/
+type bitcodeJob struct {
+	src    string   // absolute path of C file
+	args   []string // clang's include args
+	macros []string // clang's -D/-U args
+	bc     string   // absolute path of bitcode file
+}
+
+///MYCODE
+//	collect C files under c_root_path and the C files generated by cgo
+//	under build/_obj/, bitcode file name contains hash of source path so
+//	that files with same name in different dirs do not clash
+func collectBitcodeJobs(cfg *cConfig) ([]*bitcodeJob, error) {
+	var jobs []*bitcodeJob
+	root, _ := filepath.Abs(*c_root_path)
+	collect_fn := func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
 		}
-		logf("gen unifdef and bitcode visit %s", path)
 		abs_path, _ := filepath.Abs(path)
+		in_obj := strings.HasPrefix(abs_path, absObjPath)
+		if !d.IsDir() || (!in_obj && (strings.Contains(path, "build") || strings.Contains(path, "_obj"))) {
+			return nil
+		}
+		logf("collect C files visit %s", path)
 		rds, _ := ioutil.ReadDir(abs_path)
-		bit_code_args := []string{"-c", "-emit-llvm"}
-		if strings.Contains(path, "_obj") {
-			bit_code_args = append(bit_code_args, "-I", abs_path+"/../", "-I", abs_path)
+		var include_args []string
+		if in_obj {
+			// generated files include headers next to the Go files
+			rel, _ := filepath.Rel(absObjPath, abs_path)
+			include_args = []string{"-I", filepath.Join(root, rel), "-I", abs_path}
 		}
 		for _, fi := range rds {
 			if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".c") || strings.Contains(fi.Name(), "_cgo_export.c") || strings.Contains(fi.Name(), "_cgo_main.c") {
 				continue
 			}
 			fi_abs_path := abs_path + "/" + fi.Name()
-			unifdef_fi_abs_path := abs_path + "/" + "unifdef_" + fi.Name()
-			tmp_args := append(DSymbols, fi_abs_path, "-o", unifdef_fi_abs_path)
-			unidef_cmd := exec.Command("unifdef", tmp_args...)
-			logf(unidef_cmd.String())
-			if b, err := unidef_cmd.CombinedOutput(); err != nil {
-				logf(string(b))
-				return nil
-			} else {
-				logf("succeed")
-			}
-			tmp_args = append(bit_code_args, "-o", absBuildPath+"/"+fi.Name()+".bc")
-			tmp_args = append(tmp_args, unifdef_fi_abs_path)
-			bit_code_cmd := exec.Command("clang-10", tmp_args...)
-			logf(bit_code_cmd.String())
-			if b, err := bit_code_cmd.CombinedOutput(); err != nil {
-				logf(string(b))
-				return nil
-			} else {
-				logf("succeed")
-			}
-			if err := os.Remove(unifdef_fi_abs_path); err != nil {
-				logf("remove %s failed", unifdef_fi_abs_path)
-				return err
-			}
+			sum := sha256.Sum256([]byte(fi_abs_path))
+			jobs = append(jobs, &bitcodeJob{
+				src:    fi_abs_path,
+				args:   include_args,
+				macros: cfg.Macros,
+				bc:     fmt.Sprintf("%s/%s.%x.bc", cfg.build, fi.Name(), sum[:4]),
+			})
 		}
 		return nil
 	}
-	return filepath.WalkDir(*c_root_path, gen_unifdef_bc_fn)
+	if err := filepath.WalkDir(*c_root_path, collect_fn); err != nil {
+		return jobs, err
+	}
+	if ok, _ := pathExists(absObjPath); !ok {
+		return jobs, nil
+	}
+	err := filepath.WalkDir(absObjPath, collect_fn)
+	return jobs, err
 }
 
 ///MYCODE
-//	copy file to build/
-func copyFileToBuild(src_path string, dst_path string) error {
-	b, err := os.ReadFile(src_path)
+//	hash of C file's content, its headers listed in clang's dep file and
+//	all flags affecting the bitcode. "" if some input can not be read
+func bitcodeHash(job *bitcodeJob) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q %q\n", job.args, job.macros)
+	b, err := ioutil.ReadFile(job.src)
 	if err != nil {
-		logf("read %s fail", src_path)
+		return ""
+	}
+	h.Write(b)
+	if deps, err := ioutil.ReadFile(job.bc + ".d"); err == nil {
+		// target: compiled_file header1 header2 \
+		//   header3
+		parts := strings.SplitN(strings.ReplaceAll(string(deps), "\\\n", " "), ":", 2)
+		if len(parts) == 2 {
+			fields := strings.Fields(parts[1])
+			for i := 1; i < len(fields); i++ {
+				b, err := ioutil.ReadFile(fields[i])
+				if err != nil {
+					return ""
+				}
+				fmt.Fprintf(h, "%s\n", fields[i])
+				h.Write(b)
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+///MYCODE
+//	compile a C file to bitcode, macros are handled by clang itself
+func compileBitcode(job *bitcodeJob) error {
+	tmp_args := []string{"-c", "-emit-llvm", "-g", "-MD", "-MF", job.bc + ".d"}
+	tmp_args = append(tmp_args, job.macros...)
+	tmp_args = append(tmp_args, job.args...)
+	tmp_args = append(tmp_args, "-o", job.bc, job.src)
+	bit_code_cmd := exec.Command("clang-10", tmp_args...)
+	if err := runCgoCmd(job.src, bit_code_cmd); err != nil {
 		return err
 	}
-	err = os.WriteFile(dst_path, b, 0644)
+	return nil
+}
+
+///MYCODE
+//	compile C files to bitcode in parallel. bitcode in build/ is reused if
+//	hash of its inputs did not change since last run, bitcode of removed
+//	C files is deleted. report whether anything in build/ changed
+func genBitCode(cfg *cConfig) (bool, error) {
+	if err := os.MkdirAll(cfg.build, 0755); err != nil {
+		return false, err
+	}
+	jobs, err := collectBitcodeJobs(cfg)
 	if err != nil {
-		logf("copy %s fail", dst_path)
+		return false, err
 	}
-	return nil
+
+	var (
+		mu      sync.Mutex
+		changed bool
+		wg      sync.WaitGroup
+	)
+	queue := make(chan *bitcodeJob)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				sum_path := job.bc + ".sum"
+				if old, err := ioutil.ReadFile(sum_path); err == nil {
+					if ok, _ := pathExists(job.bc); ok && bitcodeHash(job) == string(old) {
+						logf("%s is up to date", job.bc)
+						continue
+					}
+				}
+				os.Remove(sum_path)
+				mu.Lock()
+				changed = true
+				mu.Unlock()
+				if err := compileBitcode(job); err != nil {
+					os.Remove(job.bc)
+					continue
+				}
+				if sum := bitcodeHash(job); sum != "" {
+					if err := ioutil.WriteFile(sum_path, []byte(sum), 0644); err != nil {
+						logf("write %s failed", sum_path)
+					}
+				}
+			}
+		}()
+	}
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+
+	// remove bitcode of C files which no longer exist
+	keep := map[string]bool{cfg.llPath: true, cfg.dotPath: true}
+	for _, job := range jobs {
+		keep[job.bc] = true
+		keep[job.bc+".d"] = true
+		keep[job.bc+".sum"] = true
+	}
+	rds, _ := ioutil.ReadDir(cfg.build)
+	for _, fi := range rds {
+		if fi.IsDir() {
+			// _obj/ of cgo
+			continue
+		}
+		if abs_path := cfg.build + "/" + fi.Name(); !keep[abs_path] {
+			logf("remove stale %s", abs_path)
+			os.Remove(abs_path)
+			changed = true
+		}
+	}
+	return changed, nil
 }
 
 ///MYCODE
 //	generate dot callgraph using bitcode files in build/
-func bc2dot() error {
+//	link and opt are skipped if no bitcode changed and outputs exist
+func bc2dot(cfg *cConfig, changed bool) error {
+	if !changed {
+		ll_ok, _ := pathExists(cfg.llPath)
+		dot_ok, _ := pathExists(cfg.dotPath)
+		if ll_ok && dot_ok {
+			logf("bitcode unchanged, reuse %s", cfg.dotPath)
+			return nil
+		}
+	}
 	link_args := []string{"-S"}
-	rds, _ := ioutil.ReadDir(buildPathStr)
+	rds, _ := ioutil.ReadDir(cfg.build)
 	for _, fi := range rds {
-		link_args = append(link_args, absBuildPath+"/"+fi.Name())
+		if strings.HasSuffix(fi.Name(), ".bc") {
+			link_args = append(link_args, cfg.build+"/"+fi.Name())
+		}
 	}
-	link_args = append(link_args, "-o", "tmp.ll")
+	link_args = append(link_args, "-o", cfg.llPath)
 	link_cmd := exec.Command("llvm-link-10", link_args...)
-	logf(link_cmd.String())
-	if b, err := link_cmd.CombinedOutput(); err != nil {
-		logf(string(b))
+	if err := runCgoCmd(cfg.llPath, link_cmd); err != nil {
 		return err
 	}
-	dot_args := []string{"-analyze", "-dot-callgraph", "tmp.ll"}
+	// opt writes callgraph.dot to its working dir
+	dot_args := []string{"-analyze", "-dot-callgraph", cfg.llPath}
 	dot_cmd := exec.Command("opt-10", dot_args...)
-	logf(dot_cmd.String())
-	if b, err := dot_cmd.CombinedOutput(); err != nil {
-		logf(string(b))
+	dot_cmd.Dir = filepath.Dir(cfg.dotPath)
+	if err := runCgoCmd(cfg.llPath, dot_cmd); err != nil {
 		return err
 	}
 	return nil
 }
 
 ///MYCODE
-//	read c_dot_path callgraph
-func getCGOdotGraphBytes() []byte {
-	outbyte, _ := ioutil.ReadFile(*c_dot_path)
+//	read dot callgraph
+func getCGOdotGraphBytes(dot_path string) []byte {
+	outbyte, _ := ioutil.ReadFile(dot_path)
 	return outbyte
 }
 
 ///MYCODE
-//	first find node in C nodes, then find node in Go nodes
-//	return node whose name matches fn, nil instead.
-func findNode(fn string, dotg *dotGraph) *dotNode {
-	nodes := dotg.Nodes
-	for _, node := range nodes {
-		if node.ID == fn {
+//	find node whose ID matches id in top-level nodes and all clusters
+//	return nil if not found
+func findNode(id string, dotg *dotGraph) *dotNode {
+	for _, node := range dotg.Nodes {
+		if node.ID == id {
 			return node
 		}
 	}
-	for _, node := range dotg.Cluster.Nodes {
-		elems := strings.Split(node.ID, ".")
-		real_fn := elems[len(elems)-1]
-		if real_fn == fn {
+	if node := findNodeInCluster(id, dotg.Cluster); node != nil {
+		return node
+	}
+	return findNodeInCluster(id, dotg.CCluster)
+}
+
+///MYCODE
+func findNodeInCluster(id string, c *dotCluster) *dotNode {
+	if c == nil {
+		return nil
+	}
+	for _, node := range c.Nodes {
+		if node.ID == id {
 			return node
 		}
 	}
-	for _, pkg_cluster := range dotg.Cluster.Clusters {
-		for _, node := range pkg_cluster.Nodes {
-			elems := strings.Split(node.ID, ".")
-			real_fn := elems[len(elems)-1]
-			if real_fn == fn {
-				return node
-			}
+	for _, sub := range c.Clusters {
+		if node := findNodeInCluster(id, sub); node != nil {
+			return node
 		}
 	}
 	return nil
@@ -207,17 +537,76 @@ func findNode(fn string, dotg *dotGraph) *dotNode {
 
 ///MYCODE
 //	return map[_Cfunc_XXX] = XXX
-func getGO2Cmap(prog *ssa.Program) map[string]string {
-	go2c := make(map[string]string)
+func getGO2Cmap(prog *ssa.Program) map[*ssa.Function]string {
+	go2c := make(map[*ssa.Function]string)
 	for fn := range ssautil.AllFunctions(prog) {
-		if strings.HasPrefix(fn.Name(), "_Cfunc_") {
-			go2c[fn.Name()] = fn.Name()[7:]
+		if fn.Pkg != nil && strings.HasPrefix(fn.Name(), "_Cfunc_") {
+			go2c[fn] = fn.Name()[7:]
 		}
 	}
 	logf("go2c map: %v\n", go2c)
 	return go2c
 }
 
+///MYCODE
+//	return map[XXX] = Go function exported to C by //export XXX
+//	cgo generates a _cgoexp_<hash>_XXX wrapper for every exported function
+func getC2GOmap(prog *ssa.Program) map[string]*ssa.Function {
+	c2go := make(map[string]*ssa.Function)
+	for fn := range ssautil.AllFunctions(prog) {
+		if fn.Pkg == nil || !strings.HasPrefix(fn.Name(), "_cgoexp_") {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(fn.Name(), "_cgoexp_"), "_", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if exported := fn.Pkg.Func(parts[1]); exported != nil {
+			c2go[parts[1]] = exported
+		}
+	}
+	logf("c2go map: %v\n", c2go)
+	return c2go
+}
+
+///MYCODE
+//	add Go callees of exported functions that are only called from C.
+//	pointer analysis starts from main, so it never reaches them; use CHA
+//	for everything reachable from the exported functions instead.
+func addCGOExportEdges(prog *ssa.Program, cg *callgraph.Graph) {
+	c2go := getC2GOmap(prog)
+	if len(c2go) == 0 {
+		return
+	}
+	analyzed := make(map[*ssa.Function]bool, len(cg.Nodes))
+	for fn := range cg.Nodes {
+		analyzed[fn] = true
+	}
+	chaGraph := cha.CallGraph(prog)
+	seen := make(map[*ssa.Function]bool)
+	var queue []*ssa.Function
+	for _, fn := range c2go {
+		queue = append(queue, fn)
+	}
+	for len(queue) > 0 {
+		fn := queue[0]
+		queue = queue[1:]
+		if seen[fn] || analyzed[fn] {
+			continue
+		}
+		seen[fn] = true
+		chaNode := chaGraph.Nodes[fn]
+		if chaNode == nil {
+			continue
+		}
+		for _, e := range chaNode.Out {
+			callgraph.AddEdge(cg.CreateNode(fn), e.Site, cg.CreateNode(e.Callee.Func))
+			logf("add exported func's edge: %s -> %s", fn, e.Callee.Func)
+			queue = append(queue, e.Callee.Func)
+		}
+	}
+}
+
 ///MYCODE
 func trim2Brace(c_fn_str string) string {
 	t := len(c_fn_str)
@@ -235,71 +624,393 @@ func getCFuncName(c_node *cgraph.Node) string {
 }
 
 ///MYCODE
-func addCGOdotGraph(prog *ssa.Program, dotg *dotGraph) *dotGraph {
-	go2c := getGO2Cmap(prog)
-	c_graph, err := graphviz.ParseBytes(getCGOdotGraphBytes())
+//	C function's location read from debug info of linked LLVM IR
+type cFuncInfo struct {
+	File    string
+	Line    int
+	Defined bool
+}
+
+///MYCODE
+//	report whether function is from C library or system headers
+func (info *cFuncInfo) isLib() bool {
+	if !info.Defined {
+		return true
+	}
+	for _, dir := range []string{"/usr/", "/Library/", "/opt/homebrew/"} {
+		if strings.HasPrefix(info.File, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	llDefineRe  = regexp.MustCompile(`^define .*@([\w.$]+)\(.*!dbg !(\d+)`)
+	llFuncRe    = regexp.MustCompile(`^(?:define|declare) .*@([\w.$]+)\(`)
+	llSubprogRe = regexp.MustCompile(`^!(\d+) = (?:distinct )?!DISubprogram\(.*\bfile: !(\d+), line: (\d+)`)
+	llFileRe    = regexp.MustCompile(`^!(\d+) = !DIFile\(filename: "([^"]*)", directory: "([^"]*)"`)
+)
+
+///MYCODE
+//	read linked LLVM IR and add map[C function name] = location to infos.
+//	functions only declared in IR are library functions, a function
+//	defined in any configuration wins over its declaration
+func getCFuncInfos(ll_path string, infos map[string]*cFuncInfo) {
+	if ll_path == "" {
+		return
+	}
+	b, err := ioutil.ReadFile(ll_path)
 	if err != nil {
-		log.Fatal("graphviz.ParseBytes error")
-	}
-	logf("\n--------------------\nget CGO callgraph bytes\n--------------------")
-	c_edges_num := c_graph.NumberEdges()
-	c_node := c_graph.FirstNode()
-	c_nodes_num := c_graph.NumberNodes()
-	logf("nodenum %d", c_nodes_num)
-	logf("edgenum %d", c_edges_num)
-	nodes_map := make(map[string]*dotNode)
-	logf("\n----------------\nget C's callgraph nodes\n----------------\n")
-	for c_node != nil {
-		//	TODO出现nextNode后panic: runtime error: invalid memory address or nil pointer dereference
-		c_fn_str := getCFuncName(c_node)
-		if c_fn_str == "" {
-			break
+		logf("read %s fail: %v", ll_path, err)
+		return
+	}
+	func_infos := make(map[string]*cFuncInfo)
+	dbgs := make(map[string]string)
+	subprogs := make(map[string][2]string)
+	files := make(map[string]string)
+	for _, line := range strings.Split(string(b), "\n") {
+		if m := llFuncRe.FindStringSubmatch(line); m != nil {
+			func_infos[m[1]] = &cFuncInfo{Defined: strings.HasPrefix(line, "define")}
+			if m := llDefineRe.FindStringSubmatch(line); m != nil {
+				dbgs[m[1]] = m[2]
+			}
+		} else if m := llSubprogRe.FindStringSubmatch(line); m != nil {
+			subprogs[m[1]] = [2]string{m[2], m[3]}
+		} else if m := llFileRe.FindStringSubmatch(line); m != nil {
+			name := m[2]
+			if !filepath.IsAbs(name) {
+				name = filepath.Join(m[3], name)
+			}
+			files[m[1]] = name
+		}
+	}
+	for fn, dbg := range dbgs {
+		if sp, ok := subprogs[dbg]; ok {
+			func_infos[fn].File = files[sp[0]]
+			func_infos[fn].Line, _ = strconv.Atoi(sp[1])
+		}
+	}
+	for fn, info := range func_infos {
+		if old, ok := infos[fn]; !ok || (!old.Defined && info.Defined) {
+			infos[fn] = info
+		}
+	}
+	logf("C func infos of %s: %d", ll_path, len(func_infos))
+}
+
+///MYCODE
+//	get cluster holding all C functions
+func cCluster(dotg *dotGraph) *dotCluster {
+	if dotg.CCluster == nil {
+		dotg.CCluster = NewDotCluster("cgo")
+		dotg.CCluster.Kind = "cgo"
+		dotg.CCluster.Attrs = dotAttrs{
+			"bgcolor":   "aliceblue",
+			"label":     "C",
+			"labelloc":  "t",
+			"labeljust": "c",
+			"fontsize":  "18",
+			"tooltip":   "C functions",
+		}
+	}
+	return dotg.CCluster
+}
+
+///MYCODE
+//	get node for C function, grouped by its source file or as library function
+func cNode(fn string, info *cFuncInfo, dotg *dotGraph) *dotNode {
+	attrs := dotAttrs{
+		"label":     fn,
+		"shape":     "ellipse",
+		"style":     "filled",
+		"fillcolor": "lightcyan",
+		"tooltip":   fmt.Sprintf("%s | C function", fn),
+	}
+	key, label, tooltip := "c", "C sources", "C functions"
+	switch {
+	case info == nil:
+	case info.isLib():
+		key, label, tooltip = "clib", "C libraries", "C library and system header functions"
+		attrs["style"] = "dashed,filled"
+		attrs["fillcolor"] = "gainsboro"
+		attrs["tooltip"] = fmt.Sprintf("%s | C library function", fn)
+	case info.File != "":
+		key, label, tooltip = info.File, filepath.Base(info.File), fmt.Sprintf("file: %s", info.File)
+		attrs["tooltip"] = fmt.Sprintf("%s | defined in %s:%d", fn, filepath.Base(info.File), info.Line)
+	}
+
+	c := cCluster(dotg)
+	if _, ok := c.Clusters[key]; !ok {
+		c.Clusters[key] = &dotCluster{
+			ID:       "c_" + key,
+			Kind:     "cfile",
+			Clusters: make(map[string]*dotCluster),
+			Attrs: dotAttrs{
+				"penwidth":  "0.8",
+				"fontsize":  "16",
+				"label":     label,
+				"style":     "filled",
+				"fillcolor": "lightcyan2",
+				"fontname":  "Tahoma bold",
+				"tooltip":   tooltip,
+			},
+		}
+		if key == "clib" {
+			c.Clusters[key].Attrs["fillcolor"] = "#eeeeee"
+		}
+	}
+	node := &dotNode{
+		ID:    fn,
+		Attrs: attrs,
+		Info:  &nodeInfo{Lang: "c"},
+	}
+	if info != nil {
+		node.Info.File, node.Info.Line, node.Info.Std = info.File, info.Line, info.isLib()
+	}
+	c.Clusters[key].Nodes = append(c.Clusters[key].Nodes, node)
+	return node
+}
+
+///MYCODE
+//	get node for Go function exported to C, create it if it is not in graph
+func exportNode(fn *ssa.Function, dotg *dotGraph) *dotNode {
+	if node := findNode(fn.String(), dotg); node != nil {
+		return node
+	}
+	node := defaultNode(fn.String())
+	node.Attrs["label"] = fn.RelString(fn.Pkg.Pkg)
+	node.Attrs["fillcolor"] = "moccasin"
+	node.Attrs["style"] = "filled"
+	node.Attrs["tooltip"] = fmt.Sprintf("%s | exported to C", fn)
+	pos := fn.Prog.Fset.Position(fn.Pos())
+	node.Info = &nodeInfo{
+		Package:  fn.Pkg.Pkg.Path(),
+		File:     pos.Filename,
+		Line:     pos.Line,
+		Exported: true,
+		Lang:     "go",
+	}
+	dotg.Nodes = append(dotg.Nodes, node)
+	return node
+}
+
+///MYCODE
+//	get edge from C caller to Go function exported to C
+func exportEdge(caller *dotNode, callee *dotNode) *dotEdge {
+	edge := defaultEdge(caller, callee)
+	edge.Attrs["color"] = "darkorchid"
+	edge.Attrs["style"] = "bold"
+	edge.Attrs["tooltip"] = fmt.Sprintf("%s calls exported %s", caller.ID, callee.ID)
+	return edge
+}
+
+///MYCODE
+//	filters of printOutput applied to the C side
+type cgoFilter struct {
+	focusPkg *types.Package
+	keepGo   func(fn *ssa.Function) bool // Go side limit/ignore/include/nostd
+	ignore   []string                    // C function name patterns
+	noclib   bool
+}
+
+///MYCODE
+//	report whether C function fn is omitted by C symbol filters
+func (f *cgoFilter) omitC(fn string, info *cFuncInfo) bool {
+	if f.noclib && info != nil && info.isLib() {
+		return true
+	}
+	for _, p := range f.ignore {
+		if ok, _ := path.Match(p, fn); ok {
+			return true
 		}
+	}
+	return false
+}
 
+///MYCODE
+//	report whether Go function fn passes Go side filters
+func (f *cgoFilter) inFocus(fn *ssa.Function) bool {
+	if f.focusPkg != nil && fn.Pkg.Pkg.Path() != f.focusPkg.Path() {
+		return false
+	}
+	return f.keepGo == nil || f.keepGo(fn)
+}
+
+///MYCODE
+//	return all functions reachable from roots following next
+func cReachable(roots []string, next map[string][]string) map[string]bool {
+	seen := make(map[string]bool)
+	for len(roots) > 0 {
+		fn := roots[0]
+		roots = roots[1:]
+		if seen[fn] {
+			continue
+		}
+		seen[fn] = true
+		roots = append(roots, next[fn]...)
+	}
+	return seen
+}
+
+///MYCODE
+//	merge C callgraphs of all configurations into dotg. with more than one
+//	configuration, C edges missing in some of them are labelled with the
+//	configurations they exist in
+func addCGOdotGraph(prog *ssa.Program, dotg *dotGraph, configs []*cConfig, filter *cgoFilter) *dotGraph {
+	go2c := getGO2Cmap(prog)
+	c2go := getC2GOmap(prog)
+	infos := make(map[string]*cFuncInfo)
+	var c_fns []string
+	seen_fns := make(map[string]bool)
+	callees := make(map[string][]string)
+	callers := make(map[string][]string)
+	edge_cfgs := make(map[[2]string][]string)
+	for _, cfg := range configs {
+		getCFuncInfos(cfg.llPath, infos)
+		c_graph, err := graphviz.ParseBytes(getCGOdotGraphBytes(cfg.dotPath))
+		if err != nil {
+			log.Fatal("graphviz.ParseBytes error")
+		}
+		logf("\n--------------------\nget CGO callgraph bytes %s\n--------------------", cfg.Name)
+		c_edges_num := c_graph.NumberEdges()
+		c_node := c_graph.FirstNode()
+		c_nodes_num := c_graph.NumberNodes()
+		logf("nodenum %d", c_nodes_num)
+		logf("edgenum %d", c_edges_num)
+		for c_node != nil {
+			//	TODO出现nextNode后panic: runtime error: invalid memory address or nil pointer dereference
+			c_fn_str := getCFuncName(c_node)
+			if c_fn_str == "" {
+				break
+			}
+			if !seen_fns[c_fn_str] {
+				seen_fns[c_fn_str] = true
+				c_fns = append(c_fns, c_fn_str)
+			}
+			out_edge := c_graph.FirstOut(c_node)
+			for out_edge != nil {
+				out_fn_str := getCFuncName(out_edge.Node())
+				if out_fn_str == "" {
+					break
+				}
+				key := [2]string{c_fn_str, out_fn_str}
+				if cfgs, ok := edge_cfgs[key]; !ok {
+					callees[c_fn_str] = append(callees[c_fn_str], out_fn_str)
+					callers[out_fn_str] = append(callers[out_fn_str], c_fn_str)
+					edge_cfgs[key] = []string{cfg.Name}
+				} else if cfgs[len(cfgs)-1] != cfg.Name {
+					edge_cfgs[key] = append(cfgs, cfg.Name)
+				}
+				out_edge = c_graph.NextOut(out_edge)
+			}
+			c_node = c_graph.NextNode(c_node)
+		}
+	}
+
+	logf("\n----------------\nfilter C's callgraph nodes\n----------------\n")
+	// Go2C edges start from _Cfunc_ wrappers left in graph by Go side filters,
+	// C2Go edges end in exported functions passing Go side filters
+	var go2cRoots, c2goRoots []string
+	for _Cfunc_XXX, XXX := range go2c {
+		if findNode(_Cfunc_XXX.String(), dotg) != nil && filter.inFocus(_Cfunc_XXX) {
+			go2cRoots = append(go2cRoots, XXX)
+		}
+	}
+	for XXX, fn := range c2go {
+		if filter.inFocus(fn) {
+			c2goRoots = append(c2goRoots, XXX)
+		}
+	}
+	keep := make(map[string]bool)
+	if filter.focusPkg == nil {
+		for _, c_fn_str := range c_fns {
+			keep[c_fn_str] = true
+		}
+		for _, XXX := range go2cRoots {
+			keep[XXX] = true
+		}
+	} else {
+		// only C functions reachable from or calling into focused package
+		for c_fn_str := range cReachable(go2cRoots, callees) {
+			keep[c_fn_str] = true
+		}
+		for c_fn_str := range cReachable(c2goRoots, callers) {
+			keep[c_fn_str] = true
+		}
+	}
+	for XXX, fn := range c2go {
+		if filter.keepGo != nil && !filter.keepGo(fn) {
+			delete(keep, XXX)
+		}
+	}
+
+	nodes_map := make(map[string]*dotNode)
+	var getNode = func(c_fn_str string) *dotNode {
+		if node, ok := nodes_map[c_fn_str]; ok {
+			return node
+		}
 		var node *dotNode
-		if node = findNode(c_fn_str, dotg); node == nil {
-			logf("%s in c side", c_fn_str)
-			node = defaultNode(c_fn_str)
-			dotg.Nodes = append(dotg.Nodes, node)
+		if fn, ok := c2go[c_fn_str]; ok {
+			logf("%s exported by go side", c_fn_str)
+			node = exportNode(fn, dotg)
+		} else if !keep[c_fn_str] || filter.omitC(c_fn_str, infos[c_fn_str]) {
+			logf("omit C function %s", c_fn_str)
 		} else {
-			logf("%s in go side", c_fn_str)
+			logf("%s in c side", c_fn_str)
+			node = cNode(c_fn_str, infos[c_fn_str], dotg)
 		}
 		nodes_map[c_fn_str] = node
-		c_node = c_graph.NextNode(c_node)
+		return node
 	}
+
 	logf("\n--------------------\nadd C edges\n--------------------\n")
-	c_node = c_graph.FirstNode()
-	for c_node != nil {
-		c_fn_str := getCFuncName(c_node)
-		if c_fn_str == "" {
-			break
-		}
-		caller := nodes_map[c_fn_str]
-		out_edge := c_graph.FirstOut(c_node)
-		for out_edge != nil {
-			out_fn_str := getCFuncName(out_edge.Node())
-			if out_fn_str == "" {
-				break
+	for _, c_fn_str := range c_fns {
+		if !keep[c_fn_str] {
+			continue
+		}
+		caller := getNode(c_fn_str)
+		if caller == nil {
+			continue
+		}
+		for _, out_fn_str := range callees[c_fn_str] {
+			if !keep[out_fn_str] {
+				continue
 			}
-			callee := nodes_map[out_fn_str]
-			dotg.Edges = append(dotg.Edges, defaultEdge(caller, callee))
-			logf("add C's edge: %s -> %s", caller.ID, callee.ID)
-			out_edge = c_graph.NextOut(out_edge)
+			callee := getNode(out_fn_str)
+			if callee == nil {
+				continue
+			}
+			var edge *dotEdge
+			if _, ok := c2go[out_fn_str]; ok {
+				edge = exportEdge(caller, callee)
+				logf("add C2Go edge: %s -> %s", caller.ID, callee.ID)
+			} else {
+				edge = defaultEdge(caller, callee)
+				logf("add C's edge: %s -> %s", caller.ID, callee.ID)
+			}
+			if cfgs := edge_cfgs[[2]string{c_fn_str, out_fn_str}]; len(cfgs) < len(configs) {
+				// edge exists only in some macro configurations
+				edge.Attrs["label"] = strings.Join(cfgs, ",")
+				edge.Attrs["fontsize"] = "10"
+				edge.Attrs["tooltip"] = fmt.Sprintf("%s -> %s | only in %s", caller.ID, callee.ID, strings.Join(cfgs, ", "))
+			}
+			dotg.Edges = append(dotg.Edges, edge)
 		}
-		c_node = c_graph.NextNode(c_node)
 	}
 	logf("\n-----------------\nadd Go2C edges\n-----------------\n")
 	for _Cfunc_XXX, XXX := range go2c {
-		caller := findNode(_Cfunc_XXX, dotg)
+		caller := findNode(_Cfunc_XXX.String(), dotg)
 		if caller == nil {
 			logf("go side %s()'s node not found", _Cfunc_XXX)
 			continue
 		}
-		callee, ok := nodes_map[XXX]
-		if !ok {
-			logf("%s not found in C side", XXX)
-			callee = defaultNode(XXX)
-			dotg.Nodes = append(dotg.Nodes, callee)
+		if !keep[XXX] {
+			continue
+		}
+		callee := getNode(XXX)
+		if callee == nil {
+			continue
 		}
 		edge := defaultEdge(caller, callee)
 		dotg.Edges = append(dotg.Edges, edge)
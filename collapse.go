@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strings"
+)
+
+// collapseKey returns the package or type a node is collapsed into, or ""
+// if the node is kept.
+func collapseKey(n *dotNode, mode string) string {
+	if n.Info == nil || n.Info.Lang != "go" || n.Info.Kind != "" {
+		return ""
+	}
+	switch mode {
+	case "pkg":
+		return n.Info.Package
+	case "type":
+		return n.Info.Type
+	}
+	return ""
+}
+
+// clusterKey returns the package or type grouped by cluster c, which is not
+// its ID if functions are also grouped by file.
+func clusterKey(c *dotCluster, mode string) string {
+	for _, n := range c.Nodes {
+		if key := collapseKey(n, mode); key != "" {
+			return key
+		}
+	}
+	for _, sub := range c.Clusters {
+		if key := clusterKey(sub, mode); key != "" {
+			return key
+		}
+	}
+	return ""
+}
+
+// collapseGraph merges all functions of each package (mode "pkg") or type
+// (mode "type") into a single node, except those listed in expanded. Edges
+// between merged nodes are weighted by the number of underlying calls.
+// urlFor, if not nil, returns the URL expanding a merged node.
+func collapseGraph(g *dotGraph, mode string, expanded []string, urlFor func(key string) string) *dotGraph {
+	keep := make(map[string]bool)
+	for _, k := range expanded {
+		keep[k] = true
+	}
+
+	// merged nodes by key, labelled like the clusters they replace
+	merged := make(map[string]*dotNode)
+	members := make(map[string]int)
+	labels := make(map[string]string)
+	g.visitClusters(func(c, _ *dotCluster) {
+		if c.Kind != mode {
+			return
+		}
+		if key := clusterKey(c, mode); labels[key] == "" {
+			labels[key] = c.Attrs["label"]
+		}
+	})
+	g.visitNodes(func(n *dotNode, _ *dotCluster) {
+		key := collapseKey(n, mode)
+		if key == "" || keep[key] {
+			return
+		}
+		members[key]++
+		m, ok := merged[key]
+		if !ok {
+			m = &dotNode{
+				ID:    mode + ":" + key,
+				Attrs: make(dotAttrs),
+				Info: &nodeInfo{
+					Package: n.Info.Package,
+					Std:     n.Info.Std,
+					Lang:    "go",
+				},
+			}
+			if mode == "type" {
+				m.Info.Type = key
+			}
+			merged[key] = m
+		}
+		m.Info.Focused = m.Info.Focused || n.Info.Focused
+	})
+	if len(merged) == 0 {
+		return g
+	}
+
+	for key, m := range merged {
+		label := labels[key]
+		if label == "" {
+			label = path.Base(key)
+		}
+		m.Attrs["label"] = fmt.Sprintf("%s\n(%d funcs)", label, members[key])
+		m.Attrs["shape"] = "folder"
+		if mode == "type" {
+			m.Attrs["shape"] = "box3d"
+		}
+		m.Attrs["style"] = "filled"
+		m.Attrs["penwidth"] = "1.5"
+		if m.Info.Focused {
+			m.Attrs["fillcolor"] = "lightblue"
+		} else if m.Info.Std {
+			m.Attrs["fillcolor"] = "#adedad"
+		} else {
+			m.Attrs["fillcolor"] = "moccasin"
+		}
+		m.Attrs["tooltip"] = fmt.Sprintf("%s: %s | %d functions", map[string]string{"pkg": "package", "type": "type"}[mode], key, members[key])
+		if urlFor != nil {
+			m.Attrs["URL"] = urlFor(key)
+			m.Attrs["tooltip"] += " (click to expand)"
+		}
+	}
+
+	// replace members by their merged node, in place of the cluster of
+	// the package or type
+	placed := make(map[string]bool)
+	var rebuild func(nodes []*dotNode, clusters map[string]*dotCluster) []*dotNode
+	rebuild = func(nodes []*dotNode, clusters map[string]*dotCluster) []*dotNode {
+		var l []*dotNode
+		for _, n := range nodes {
+			key := collapseKey(n, mode)
+			if m, ok := merged[key]; !ok {
+				l = append(l, n)
+			} else if !placed[key] {
+				placed[key] = true
+				l = append(l, m)
+			}
+		}
+		for id, c := range clusters {
+			if key := clusterKey(c, mode); c.Kind == mode && merged[key] != nil {
+				delete(clusters, id)
+				if !placed[key] {
+					placed[key] = true
+					l = append(l, merged[key])
+				}
+				continue
+			}
+			c.Nodes = rebuild(c.Nodes, c.Clusters)
+		}
+		return l
+	}
+	for _, c := range []*dotCluster{g.Cluster, g.CCluster} {
+		if c != nil {
+			c.Nodes = rebuild(c.Nodes, c.Clusters)
+		}
+	}
+	g.Nodes = rebuild(g.Nodes, nil)
+
+	var node = func(n *dotNode) *dotNode {
+		if m, ok := merged[collapseKey(n, mode)]; ok {
+			return m
+		}
+		return n
+	}
+
+	type pair struct {
+		from, to string
+		calls    int
+	}
+	type bundle struct {
+		edge  *dotEdge
+		pairs []pair
+		calls int
+	}
+	var edges []*dotEdge
+	bundles := make(map[[2]*dotNode]*bundle)
+	var order []*bundle
+	for _, e := range g.Edges {
+		from, to := node(e.From), node(e.To)
+		if from == e.From && to == e.To {
+			edges = append(edges, e)
+			continue
+		}
+		if from == to {
+			// calls inside a merged package or type
+			continue
+		}
+		calls := 1
+		if e.Info != nil && len(e.Info.Positions) > 0 {
+			calls = len(e.Info.Positions)
+		}
+		b, ok := bundles[[2]*dotNode{from, to}]
+		if !ok {
+			attrs := make(dotAttrs)
+			for k, v := range e.Attrs {
+				attrs[k] = v
+			}
+			// the clusters of merged nodes are gone
+			delete(attrs, "ltail")
+			delete(attrs, "lhead")
+			info := &edgeInfo{Kind: "call"}
+			if e.Info != nil {
+				info.Kind, info.Dynamic = e.Info.Kind, e.Info.Dynamic
+			}
+			b = &bundle{edge: &dotEdge{From: from, To: to, Attrs: attrs, Info: info}}
+			bundles[[2]*dotNode{from, to}] = b
+			order = append(order, b)
+		} else {
+			// keep styles shared by all underlying calls only
+			for _, k := range []string{"style", "arrowhead", "color", "label"} {
+				if b.edge.Attrs[k] != e.Attrs[k] {
+					delete(b.edge.Attrs, k)
+				}
+			}
+			if e.Info == nil || e.Info.Kind != b.edge.Info.Kind {
+				b.edge.Info.Kind = "call"
+			}
+			b.edge.Info.Dynamic = b.edge.Info.Dynamic && e.Info != nil && e.Info.Dynamic
+		}
+		if e.Info != nil {
+			b.edge.Info.Positions = append(b.edge.Info.Positions, e.Info.Positions...)
+		}
+		b.pairs = append(b.pairs, pair{e.From.ID, e.To.ID, calls})
+		b.calls += calls
+	}
+
+	const topPairs = 5
+	for _, b := range order {
+		sort.SliceStable(b.pairs, func(i, j int) bool { return b.pairs[i].calls > b.pairs[j].calls })
+		lines := []string{fmt.Sprintf("%d calls", b.calls)}
+		for i, p := range b.pairs {
+			if i == topPairs {
+				lines = append(lines, fmt.Sprintf("... and %d more", len(b.pairs)-topPairs))
+				break
+			}
+			lines = append(lines, fmt.Sprintf("%s -> %s (%d)", p.from, p.to, p.calls))
+		}
+		b.edge.Attrs["tooltip"] = strings.Join(lines, "\n")
+		b.edge.Attrs["label"] = fmt.Sprint(b.calls)
+		b.edge.Attrs["weight"] = fmt.Sprint(b.calls)
+		b.edge.Attrs["penwidth"] = fmt.Sprintf("%.1f", 1+math.Log2(float64(b.calls)))
+		edges = append(edges, b.edge)
+	}
+	g.Edges = edges
+	return g
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ofabry/go-callvis/internal/pointer"
+	"golang.org/x/tools/go/ssa"
+)
+
+// chanOp is a send, receive or close of a channel value.
+type chanOp struct {
+	fn    *ssa.Function
+	op    string // send, recv or close
+	ch    ssa.Value
+	pos   token.Pos
+	chans []*ssa.MakeChan // channels ch may refer to
+}
+
+// concurrency holds the channel operations of the program and the
+// sync.WaitGroup and sync.(RW)Mutex methods called by each function.
+type concurrency struct {
+	ops   []*chanOp
+	syncs map[*ssa.Function][]string
+}
+
+// syncTypes are the types of package sync whose method calls are noted.
+var syncTypes = map[string]bool{
+	"WaitGroup": true,
+	"Mutex":     true,
+	"RWMutex":   true,
+}
+
+// addChanQueries collects the channel operations and sync calls of prog,
+// adding a pointer query for each operated channel. The channels are
+// resolved by resolve once the analysis is done.
+func addChanQueries(funcs map[*ssa.Function]bool, config *pointer.Config) *concurrency {
+	c := &concurrency{syncs: make(map[*ssa.Function][]string)}
+	var add = func(fn *ssa.Function, op string, ch ssa.Value, pos token.Pos) {
+		if !pointer.CanPoint(ch.Type()) {
+			return
+		}
+		config.AddQuery(ch)
+		c.ops = append(c.ops, &chanOp{fn: fn, op: op, ch: ch, pos: pos})
+	}
+	for fn := range funcs {
+		for _, b := range fn.Blocks {
+			for _, instr := range b.Instrs {
+				switch instr := instr.(type) {
+				case *ssa.Send:
+					add(fn, "send", instr.Chan, instr.Pos())
+				case *ssa.UnOp:
+					if instr.Op == token.ARROW {
+						add(fn, "recv", instr.X, instr.Pos())
+					}
+				case *ssa.Select:
+					for _, st := range instr.States {
+						if st.Dir == types.SendOnly {
+							add(fn, "send", st.Chan, st.Pos)
+						} else {
+							add(fn, "recv", st.Chan, st.Pos)
+						}
+					}
+				case ssa.CallInstruction:
+					common := instr.Common()
+					if b, ok := common.Value.(*ssa.Builtin); ok && b.Name() == "close" && len(common.Args) == 1 {
+						add(fn, "close", common.Args[0], instr.Pos())
+					} else if note := syncNote(fn, common.StaticCallee()); note != "" {
+						c.addSync(fn, note)
+					}
+				}
+			}
+		}
+	}
+	return c
+}
+
+// syncNote returns the sync type and method name of fn if it is a method
+// of the syncTypes, e.g. "WaitGroup.Wait", or "" for other functions and
+// for calls in package sync itself, which say nothing about its users.
+func syncNote(caller, fn *ssa.Function) string {
+	if fn == nil || fn.Signature.Recv() == nil || fn.Pkg == nil || fn.Pkg.Pkg.Path() != "sync" {
+		return ""
+	}
+	if pkg := funcPkg(caller); pkg == nil || pkg.Path() == "sync" {
+		return ""
+	}
+	t := namedType(fn.Signature.Recv().Type())
+	if t == nil || !syncTypes[t.Name()] {
+		return ""
+	}
+	return fmt.Sprintf("%s.%s", t.Name(), fn.Name())
+}
+
+func (c *concurrency) addSync(fn *ssa.Function, note string) {
+	for _, n := range c.syncs[fn] {
+		if n == note {
+			return
+		}
+	}
+	c.syncs[fn] = append(c.syncs[fn], note)
+}
+
+// resolve sets the channels of the operations from the pointer queries
+// added by addChanQueries.
+func (c *concurrency) resolve(result *pointer.Result) {
+	for _, op := range c.ops {
+		ptr, ok := result.Queries[op.ch]
+		if !ok {
+			continue
+		}
+		for _, l := range ptr.PointsTo().Labels() {
+			if mc, ok := l.Value().(*ssa.MakeChan); ok {
+				op.chans = append(op.chans, mc)
+			}
+		}
+	}
+}
+
+// view adds channel nodes to g, connected to the functions of
+// nodes sending to them and receiving from them, and notes the sync calls
+// of these functions in their labels. Channels none of these functions
+// operate on are omitted. Nodes are placed in focusCluster if they belong
+// to the focused package.
+func (c *concurrency) view(prog *ssa.Program, g *dotGraph, nodes map[string]*dotNode, focusPkg *types.Package, focusCluster *dotCluster) {
+	chanNodes := make(map[*ssa.MakeChan]*dotNode)
+	opEdges := make(map[string]*dotEdge)
+	var chanNode = func(mc *ssa.MakeChan) *dotNode {
+		if n, ok := chanNodes[mc]; ok {
+			return n
+		}
+		pos := prog.Fset.Position(mc.Pos())
+		label := types.TypeString(mc.Type(), types.RelativeTo(funcPkg(mc.Parent())))
+		if k, ok := mc.Size.(*ssa.Const); !ok {
+			label += " (buffered)"
+		} else if k.Int64() > 0 {
+			label += fmt.Sprintf(" (cap %d)", k.Int64())
+		}
+		isFocused := focusPkg != nil && funcPkg(mc.Parent()).Path() == focusPkg.Path()
+		n := &dotNode{
+			ID: fmt.Sprintf("chan@%s:%d:%d", pos.Filename, pos.Line, pos.Column),
+			Attrs: dotAttrs{
+				"label":     fmt.Sprintf("%s\n%s:%d", label, filepath.Base(pos.Filename), pos.Line),
+				"shape":     "cylinder",
+				"style":     "filled",
+				"fillcolor": "#d4f0f0",
+				"tooltip":   fmt.Sprintf("channel %s | made in %s at %s:%d", mc.Type(), mc.Parent(), filepath.Base(pos.Filename), pos.Line),
+			},
+			Info: &nodeInfo{
+				Package: funcPkg(mc.Parent()).Path(),
+				File:    pos.Filename,
+				Line:    pos.Line,
+				Focused: isFocused,
+				Lang:    "go",
+				Kind:    "chan",
+			},
+		}
+		if isFocused {
+			focusCluster.Nodes = append(focusCluster.Nodes, n)
+		} else {
+			g.Nodes = append(g.Nodes, n)
+		}
+		chanNodes[mc] = n
+		return n
+	}
+
+	for _, op := range c.ops {
+		fn, ok := nodes[op.fn.String()]
+		if !ok {
+			continue
+		}
+		pos := prog.Fset.Position(op.pos)
+		posOp := fmt.Sprintf("%s:%d", pos.Filename, pos.Line)
+		for _, mc := range op.chans {
+			ch := chanNode(mc)
+			from, to := fn, ch
+			if op.op == "recv" {
+				from, to = ch, fn
+			}
+			key := fmt.Sprintf("%s = %s => %s", from.ID, op.op, to.ID)
+			e, ok := opEdges[key]
+			if !ok {
+				e = &dotEdge{
+					From: from,
+					To:   to,
+					Attrs: dotAttrs{
+						"label":     op.op,
+						"color":     "#2a9d8f",
+						"fontcolor": "#2a9d8f",
+						"fontsize":  "10",
+						"arrowhead": "vee",
+					},
+					Info: &edgeInfo{Kind: op.op},
+				}
+				if op.op == "close" {
+					e.Attrs["arrowhead"] = "tee"
+					e.Attrs["style"] = "dashed"
+				}
+				opEdges[key] = e
+				g.Edges = append(g.Edges, e)
+			}
+			e.Info.Positions = append(e.Info.Positions, posOp)
+			line := fmt.Sprintf("at %s:%d: %s", filepath.Base(pos.Filename), pos.Line, op.op)
+			if e.Attrs["tooltip"] == "" {
+				e.Attrs["tooltip"] = line
+			} else if !strings.Contains(e.Attrs["tooltip"], line) {
+				e.Attrs["tooltip"] += "\n" + line
+			}
+		}
+	}
+
+	var fns []*ssa.Function
+	for fn := range c.syncs {
+		fns = append(fns, fn)
+	}
+	sort.Slice(fns, func(i, j int) bool { return fns[i].String() < fns[j].String() })
+	for _, fn := range fns {
+		n, ok := nodes[fn.String()]
+		if !ok {
+			continue
+		}
+		notes := strings.Join(c.syncs[fn], " ")
+		n.Attrs["label"] = fmt.Sprintf("%s\n[%s]", n.Attrs["label"], notes)
+		n.Attrs["tooltip"] = fmt.Sprintf("%s\nsync: %s", n.Attrs["tooltip"], notes)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"path/filepath"
+
+	"golang.org/x/tools/cover"
+	"golang.org/x/tools/go/ssa"
+)
+
+// coverage holds the blocks of a Go coverage profile by file, the file
+// being named by the import path of its package and its base name.
+type coverage struct {
+	files map[string][]cover.ProfileBlock
+}
+
+// readCoverProfile reads the coverage profile written by go test
+// -coverprofile to path.
+func readCoverProfile(path string) (*coverage, error) {
+	profiles, err := cover.ParseProfiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading coverage profile: %v", err)
+	}
+	c := &coverage{files: make(map[string][]cover.ProfileBlock)}
+	for _, p := range profiles {
+		c.files[p.FileName] = append(c.files[p.FileName], p.Blocks...)
+	}
+	return c, nil
+}
+
+// funcCoverage returns the number of statements of fn covered and in
+// total, like go tool cover -func does, joining blocks to fn by the extent
+// of its syntax. ok is false if the profile has no statements of fn.
+func (c *coverage) funcCoverage(fset *token.FileSet, fn *ssa.Function) (covered, total int, ok bool) {
+	if c == nil || funcPkg(fn) == nil || fn.Syntax() == nil {
+		return 0, 0, false
+	}
+	syntax := fn.Syntax()
+	start, end := fset.Position(syntax.Pos()), fset.Position(syntax.End())
+	file := funcPkg(fn).Path() + "/" + filepath.Base(start.Filename)
+	for _, b := range c.files[file] {
+		if b.StartLine < start.Line || b.StartLine == start.Line && b.StartCol < start.Column ||
+			b.EndLine > end.Line || b.EndLine == end.Line && b.EndCol > end.Column {
+			continue
+		}
+		total += b.NumStmt
+		if b.Count > 0 {
+			covered += b.NumStmt
+		}
+	}
+	return covered, total, total > 0
+}
+
+// fullyCovered reports whether all statements of fn are covered.
+func (c *coverage) fullyCovered(fset *token.FileSet, fn *ssa.Function) bool {
+	covered, total, ok := c.funcCoverage(fset, fn)
+	return ok && covered == total
+}
+
+// coverageColor returns a fill color for a coverage percentage, from red
+// for 0% over yellow for 50% to green for 100%.
+func coverageColor(pct float64) string {
+	stops := [][3]float64{
+		{0xf4, 0x9a, 0x9a},
+		{0xf7, 0xe0, 0x8f},
+		{0x9a, 0xe0, 0x9a},
+	}
+	from, to, t := stops[0], stops[1], pct/50
+	if pct > 50 {
+		from, to, t = stops[1], stops[2], (pct-50)/50
+	}
+	var rgb [3]int
+	for i := range rgb {
+		rgb[i] = int(from[i] + (to[i]-from[i])*t + 0.5)
+	}
+	return fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2])
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+type cytoscapeElement struct {
+	Group   string                 `json:"group"`
+	Data    map[string]interface{} `json:"data"`
+	Classes string                 `json:"classes,omitempty"`
+}
+
+// cytoscapeElements returns the graph as Cytoscape.js elements. Clusters
+// become compound nodes which are parents of their nodes.
+func (g *dotGraph) cytoscapeElements() []cytoscapeElement {
+	var elems []cytoscapeElement
+	g.visitClusters(func(c, parent *dotCluster) {
+		data := map[string]interface{}{
+			"id":    c.String(),
+			"label": c.Attrs["label"],
+			"kind":  c.Kind,
+		}
+		if parent != nil {
+			data["parent"] = parent.String()
+		}
+		elems = append(elems, cytoscapeElement{Group: "nodes", Data: data, Classes: "cluster " + c.Kind})
+	})
+	g.visitNodes(func(n *dotNode, c *dotCluster) {
+		data := nodeValues(n, c)
+		data["id"] = n.ID
+		delete(data, "cluster")
+		if c != nil {
+			data["parent"] = c.String()
+		}
+		elems = append(elems, cytoscapeElement{Group: "nodes", Data: data})
+	})
+	for i, e := range g.sortedEdges() {
+		data := edgeValues(e)
+		data["id"] = fmt.Sprintf("e%d", i)
+		data["source"] = e.From.ID
+		data["target"] = e.To.ID
+		if e.Info != nil {
+			data["positions"] = e.Info.Positions
+		}
+		elems = append(elems, cytoscapeElement{Group: "edges", Data: data})
+	}
+	return elems
+}
+
+// WriteCytoscape writes the graph as Cytoscape.js JSON, which can be
+// passed to cytoscape({elements: ...}) or imported by Cytoscape desktop.
+func (g *dotGraph) WriteCytoscape(w io.Writer) error {
+	doc := struct {
+		Data     map[string]interface{} `json:"data"`
+		Elements []cytoscapeElement     `json:"elements"`
+	}{
+		Data:     map[string]interface{}{"name": g.Title, "warning": g.Warning},
+		Elements: g.cytoscapeElements(),
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var d2Escaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+)
+
+// d2Text quotes s for use as a D2 label.
+func d2Text(s string) string {
+	return `"` + d2Escaper.Replace(s) + `"`
+}
+
+type d2Writer struct {
+	w     *bufio.Writer
+	ids   map[*dotNode]string // full path of node, e.g. s0.s1.n2
+	nodes int
+	subs  int
+}
+
+// d2Style writes D2 style fields converted from Graphviz attributes.
+func d2Style(w io.Writer, attrs dotAttrs, fill string, indent string) {
+	if fill != "" {
+		fmt.Fprintf(w, "%sstyle.fill: %s\n", indent, d2Text(cssColor(fill)))
+	}
+	if c := attrs["color"]; c != "" {
+		fmt.Fprintf(w, "%sstyle.stroke: %s\n", indent, d2Text(cssColor(c)))
+	}
+	switch s := attrs["style"]; {
+	case strings.Contains(s, "dotted"):
+		fmt.Fprintf(w, "%sstyle.stroke-dash: 2\n", indent)
+	case strings.Contains(s, "dashed"):
+		fmt.Fprintf(w, "%sstyle.stroke-dash: 5\n", indent)
+	case strings.Contains(s, "bold"):
+		fmt.Fprintf(w, "%sstyle.stroke-width: 3\n", indent)
+	}
+}
+
+func (d *d2Writer) node(n *dotNode, path, indent string) {
+	id := fmt.Sprintf("n%d", d.nodes)
+	d.nodes++
+	d.ids[n] = path + id
+
+	label := n.Attrs["label"]
+	if label == "" {
+		label = n.ID
+	}
+	fmt.Fprintf(d.w, "%s%s: %s {\n", indent, id, d2Text(label))
+	if n.Attrs["shape"] == "ellipse" {
+		fmt.Fprintf(d.w, "%s  shape: oval\n", indent)
+	} else if strings.Contains(nodestyle, "rounded") {
+		fmt.Fprintf(d.w, "%s  style.border-radius: 6\n", indent)
+	}
+	if t := n.Attrs["tooltip"]; t != "" {
+		fmt.Fprintf(d.w, "%s  tooltip: %s\n", indent, d2Text(t))
+	}
+	d2Style(d.w, n.Attrs, n.Attrs["fillcolor"], indent+"  ")
+	// exported: bold border, unexported: normal border
+	if n.Attrs["penwidth"] == "1.5" {
+		fmt.Fprintf(d.w, "%s  style.stroke-width: 3\n", indent)
+	}
+	fmt.Fprintf(d.w, "%s}\n", indent)
+}
+
+func (d *d2Writer) cluster(c *dotCluster, path, indent string) {
+	id := fmt.Sprintf("s%d", d.subs)
+	d.subs++
+
+	fmt.Fprintf(d.w, "%s%s: %s {\n", indent, id, d2Text(c.Attrs["label"]))
+	if t := c.Attrs["tooltip"]; t != "" {
+		fmt.Fprintf(d.w, "%s  tooltip: %s\n", indent, d2Text(t))
+	}
+	fill := c.Attrs["fillcolor"]
+	if fill == "" {
+		fill = c.Attrs["bgcolor"]
+	}
+	d2Style(d.w, dotAttrs{}, fill, indent+"  ")
+	d.clusterBody(c, path+id+".", indent+"  ")
+	fmt.Fprintf(d.w, "%s}\n", indent)
+}
+
+func (d *d2Writer) clusterBody(c *dotCluster, path, indent string) {
+	for _, n := range sortedNodes(c.Nodes) {
+		d.node(n, path, indent)
+	}
+	for _, sub := range c.sortedClusters() {
+		d.cluster(sub, path, indent)
+	}
+}
+
+// WriteD2 writes the graph as a D2 diagram. Clusters become containers and
+// edges keep the legend styles: dashed dynamic calls, brown external calls,
+// a circle head for go and a diamond head for defer calls.
+func (g *dotGraph) WriteD2(w io.Writer) error {
+	d := &d2Writer{
+		w:   bufio.NewWriter(w),
+		ids: make(map[*dotNode]string),
+	}
+
+	switch g.Options["rankdir"] {
+	case "RL":
+		fmt.Fprintln(d.w, "direction: left")
+	case "TB":
+		fmt.Fprintln(d.w, "direction: down")
+	case "BT":
+		fmt.Fprintln(d.w, "direction: up")
+	default:
+		fmt.Fprintln(d.w, "direction: right")
+	}
+	title := g.Title
+	if g.Warning != "" {
+		title = fmt.Sprintf("%s\n%s", g.Warning, title)
+	}
+	fmt.Fprintf(d.w, "title: %s {\n  shape: text\n  near: top-left\n}\n", d2Text(title))
+
+	if g.Cluster != nil {
+		// the root cluster is only drawn when it is labelled by focus
+		if g.Cluster.Attrs["label"] != "" {
+			d.cluster(g.Cluster, "", "")
+		} else {
+			d.clusterBody(g.Cluster, "", "")
+		}
+	}
+	if g.CCluster != nil {
+		d.cluster(g.CCluster, "", "")
+	}
+	for _, n := range sortedNodes(g.Nodes) {
+		d.node(n, "", "")
+	}
+
+	for _, e := range g.sortedEdges() {
+		for _, n := range []*dotNode{e.From, e.To} {
+			if _, ok := d.ids[n]; !ok {
+				d.node(n, "", "")
+			}
+		}
+
+		fmt.Fprintf(d.w, "%s -> %s", d.ids[e.From], d.ids[e.To])
+		if labels := e.labels(); len(labels) > 0 {
+			fmt.Fprintf(d.w, ": %s", d2Text(strings.Join(labels, " ")))
+		}
+
+		var style bytes.Buffer
+		attrs := dotAttrs{"color": e.Attrs["color"]}
+		if e.dashed() {
+			attrs["style"] = "dashed"
+		} else {
+			attrs["style"] = e.Attrs["style"]
+		}
+		d2Style(&style, attrs, "", "  ")
+		switch e.callKind() {
+		case "go":
+			fmt.Fprintln(&style, "  target-arrowhead.shape: circle")
+			fmt.Fprintln(&style, "  target-arrowhead.style.filled: false")
+		case "defer":
+			fmt.Fprintln(&style, "  target-arrowhead.shape: diamond")
+			fmt.Fprintln(&style, "  target-arrowhead.style.filled: false")
+		}
+		if style.Len() > 0 {
+			fmt.Fprintf(d.w, " {\n%s}", style.String())
+		}
+		fmt.Fprintln(d.w)
+	}
+
+	return d.w.Flush()
+}
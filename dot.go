@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"text/template"
 
@@ -26,8 +27,8 @@ var (
 // it's usually at: /usr/bin/dot
 var dotExe string
 
-// dotToImageGraphviz generates a SVG using the 'dot' utility, returning the filepath
-func dotToImageGraphviz(outfname string, format string, dot []byte) (string, error) {
+// dotToImageGraphviz generates a SVG using the 'dot' utility, writing it to img
+func dotToImageGraphviz(img string, format string, dot []byte) error {
 	if dotExe == "" {
 		dot, err := exec.LookPath("dot")
 		if err != nil {
@@ -36,31 +37,38 @@ func dotToImageGraphviz(outfname string, format string, dot []byte) (string, err
 		dotExe = dot
 	}
 
-	var img string
-	if outfname == "" {
-		img = filepath.Join(os.TempDir(), fmt.Sprintf("go-callvis_export.%s", format))
-	} else {
-		img = fmt.Sprintf("%s.%s", outfname, format)
-	}
 	cmd := exec.Command(dotExe, fmt.Sprintf("-T%s", format), "-o", img)
 	cmd.Stdin = bytes.NewReader(dot)
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("command '%v': %v\n%v", cmd, err, stderr.String())
+		return fmt.Errorf("command '%v': %v\n%v", cmd, err, stderr.String())
 	}
-	return img, nil
+	return nil
 }
 
+// dotToImage renders dot to <outfname>.<format>, or to a temporary file if
+// outfname is empty, returning the filepath
 func dotToImage(outfname string, format string, dot []byte) (string, error) {
+	var img string
+	if outfname == "" {
+		img = filepath.Join(os.TempDir(), fmt.Sprintf("go-callvis_export.%s", format))
+	} else {
+		img = fmt.Sprintf("%s.%s", outfname, format)
+	}
+	return img, dotToImageFile(img, format, dot)
+}
+
+// dotToImageFile renders dot to the image file img
+func dotToImageFile(img string, format string, dot []byte) error {
 	if *graphvizFlag {
-		return dotToImageGraphviz(outfname, format, dot)
+		return dotToImageGraphviz(img, format, dot)
 	}
 
 	g := graphviz.New()
 	graph, err := graphviz.ParseBytes(dot)
 	if err != nil {
-		return "", err
+		return err
 	}
 	defer func() {
 		if err := graph.Close(); err != nil {
@@ -68,16 +76,7 @@ func dotToImage(outfname string, format string, dot []byte) (string, error) {
 		}
 		g.Close()
 	}()
-	var img string
-	if outfname == "" {
-		img = filepath.Join(os.TempDir(), fmt.Sprintf("go-callvis_export.%s", format))
-	} else {
-		img = fmt.Sprintf("%s.%s", outfname, format)
-	}
-	if err := g.RenderFilename(graph, graphviz.Format(format), img); err != nil {
-		return "", err
-	}
-	return img, nil
+	return g.RenderFilename(graph, graphviz.Format(format), img)
 }
 
 const tmplCluster = `{{define "cluster" -}}
@@ -101,7 +100,12 @@ const tmplEdge = `{{define "node" -}}
 {{- end}}`
 
 const tmplGraph = `digraph gocallvis {
+    {{- if .Warning}}
+    label=<<table border="0" cellspacing="0"><tr><td bgcolor="#ffcc66">&#9888; {{.Warning | html}}</td></tr><tr><td align="left">{{.Title | html}}</td></tr></table>>;
+    labelloc="t";
+    {{- else}}
     label="{{.Title}}";
+    {{- end}}
     labeljust="l";
     fontname="Arial";
     fontsize="14";
@@ -111,12 +115,23 @@ const tmplGraph = `digraph gocallvis {
     penwidth="0.5";
     pad="0.0";
     nodesep="{{.Options.nodesep}}";
+    {{- if eq .Options.compound "true"}}
+    compound="true";
+    {{- end}}
 
     node [shape="{{.Options.nodeshape}}" style="{{.Options.nodestyle}}" fillcolor="honeydew" fontname="Verdana" penwidth="1.0" margin="0.05,0.0"];
     edge [minlen="{{.Options.minlen}}"]
 
     {{template "cluster" .Cluster}}
 
+    {{- if .CCluster}}
+    {{template "cluster" .CCluster}}
+    {{- end}}
+
+    {{- range .Nodes}}
+    {{template "node" .}}
+    {{- end}}
+
     {{- range .Edges}}
     {{template "edge" .}}
     {{- end}}
@@ -126,6 +141,7 @@ const tmplGraph = `digraph gocallvis {
 //==[ type def/func: dotCluster ]===============================================
 type dotCluster struct {
 	ID       string
+	Kind     string // focus, module, dir, pkg, file, type, cgo, cfile
 	Clusters map[string]*dotCluster
 	Nodes    []*dotNode
 	Attrs    dotAttrs
@@ -143,10 +159,40 @@ func (c *dotCluster) String() string {
 	return fmt.Sprintf("cluster_%s", c.ID)
 }
 
+// sortedClusters returns sub clusters ordered by key, for stable output.
+func (c *dotCluster) sortedClusters() []*dotCluster {
+	keys := make([]string, 0, len(c.Clusters))
+	for k := range c.Clusters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	l := make([]*dotCluster, 0, len(keys))
+	for _, k := range keys {
+		l = append(l, c.Clusters[k])
+	}
+	return l
+}
+
 //==[ type def/func: dotNode    ]===============================================
 type dotNode struct {
 	ID    string
 	Attrs dotAttrs
+	Info  *nodeInfo
+}
+
+// nodeInfo holds call graph data of a node for graph exchange formats.
+type nodeInfo struct {
+	Package  string
+	Module   string
+	Type     string // receiver type of methods
+	File     string
+	Line     int
+	Exported bool
+	Std      bool // standard library or C library
+	Focused  bool
+	Lang     string // go or c
+	Kind     string // empty for functions, dispatch, spawn or chan
+	Generic  string // generic function of instantiations
 }
 
 func (n *dotNode) String() string {
@@ -158,11 +204,62 @@ type dotEdge struct {
 	From  *dotNode
 	To    *dotNode
 	Attrs dotAttrs
+	Info  *edgeInfo
+}
+
+// edgeInfo holds call graph data of an edge for graph exchange formats.
+type edgeInfo struct {
+	Kind      string // call, go, defer, dispatch, embeds, passes, send, recv, close, profile, runtime or platform
+	Dynamic   bool
+	Positions []string // file:line of call sites
+}
+
+// callKind returns "go" or "defer" for concurrent and deferred calls.
+func (e *dotEdge) callKind() string {
+	switch {
+	case strings.HasSuffix(e.Attrs["arrowhead"], "odot"):
+		return "go"
+	case strings.HasSuffix(e.Attrs["arrowhead"], "odiamond"):
+		return "defer"
+	}
+	return ""
+}
+
+// dashed reports whether the edge is drawn as a dashed line (dynamic call).
+func (e *dotEdge) dashed() bool {
+	s := e.Attrs["style"]
+	return strings.Contains(s, "dashed") || strings.Contains(s, "dotted")
+}
+
+// labels returns the call kind and edge label for text formats.
+func (e *dotEdge) labels() []string {
+	var l []string
+	if k := e.callKind(); k != "" {
+		l = append(l, k)
+	}
+	if s := e.Attrs["label"]; s != "" {
+		l = append(l, s)
+	}
+	return l
 }
 
 //==[ type def/func: dotAttrs   ]===============================================
 type dotAttrs map[string]string
 
+// X11 colors used in the graph which are not CSS color names
+var cssColors = map[string]string{
+	"lightcyan2": "#d1eeee",
+	"wheat2":     "#eed8ae",
+}
+
+// cssColor translates a Graphviz color for formats using CSS colors.
+func cssColor(c string) string {
+	if css, ok := cssColors[c]; ok {
+		return css
+	}
+	return c
+}
+
 func (p dotAttrs) List() []string {
 	l := []string{}
 	for k, v := range p {
@@ -181,13 +278,83 @@ func (p dotAttrs) Lines() string {
 
 //==[ type def/func: dotGraph   ]===============================================
 type dotGraph struct {
-	Title   string
-	Minlen  uint
-	Attrs   dotAttrs
-	Cluster *dotCluster
-	Nodes   []*dotNode
-	Edges   []*dotEdge
-	Options map[string]string
+	Title    string
+	Minlen   uint
+	Attrs    dotAttrs
+	Cluster  *dotCluster
+	CCluster *dotCluster
+	Warning  string
+	Nodes    []*dotNode
+	Edges    []*dotEdge
+	Options  map[string]string
+}
+
+// graphWriter writes the call graph in a text format which is not
+// rendered by Graphviz.
+type graphWriter struct {
+	ext   string
+	write func(g *dotGraph, w io.Writer) error
+}
+
+var graphWriters = map[string]graphWriter{
+	"mermaid":   {ext: "mmd", write: (*dotGraph).WriteMermaid},
+	"plantuml":  {ext: "puml", write: (*dotGraph).WritePlantUML},
+	"d2":        {ext: "d2", write: (*dotGraph).WriteD2},
+	"graphml":   {ext: "graphml", write: (*dotGraph).WriteGraphML},
+	"gexf":      {ext: "gexf", write: (*dotGraph).WriteGEXF},
+	"cytoscape": {ext: "json", write: (*dotGraph).WriteCytoscape},
+	"html":      {ext: "html", write: (*dotGraph).WriteHTML},
+}
+
+// sortedNodes returns nodes ordered by ID, for stable output.
+func sortedNodes(nodes []*dotNode) []*dotNode {
+	l := append([]*dotNode{}, nodes...)
+	sort.SliceStable(l, func(i, j int) bool {
+		return l[i].ID < l[j].ID
+	})
+	return l
+}
+
+// sortedEdges returns edges ordered by caller and callee, for stable output.
+func (g *dotGraph) sortedEdges() []*dotEdge {
+	l := append([]*dotEdge{}, g.Edges...)
+	sort.SliceStable(l, func(i, j int) bool {
+		if l[i].From.ID != l[j].From.ID {
+			return l[i].From.ID < l[j].From.ID
+		}
+		return l[i].To.ID < l[j].To.ID
+	})
+	return l
+}
+
+// visitClusters calls fn for every cluster of the graph with its parent,
+// which is nil for top level clusters.
+func (g *dotGraph) visitClusters(fn func(c, parent *dotCluster)) {
+	var visit func(c, parent *dotCluster)
+	visit = func(c, parent *dotCluster) {
+		fn(c, parent)
+		for _, sub := range c.sortedClusters() {
+			visit(sub, c)
+		}
+	}
+	for _, c := range []*dotCluster{g.Cluster, g.CCluster} {
+		if c != nil {
+			visit(c, nil)
+		}
+	}
+}
+
+// visitNodes calls fn for every node of the graph with its innermost
+// cluster, which is nil for top level nodes.
+func (g *dotGraph) visitNodes(fn func(n *dotNode, c *dotCluster)) {
+	g.visitClusters(func(c, _ *dotCluster) {
+		for _, n := range sortedNodes(c.Nodes) {
+			fn(n, c)
+		}
+	})
+	for _, n := range sortedNodes(g.Nodes) {
+		fn(n, nil)
+	}
 }
 
 func (g *dotGraph) WriteDot(w io.Writer) error {
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+)
+
+type promotedCall struct {
+	site   ssa.CallInstruction
+	callee *ssa.Function
+}
+
+// promotionPath is the embedding path of a promoted method, e.g. "G.F.C"
+// for a method of C called on G, and the named types along it.
+type promotionPath struct {
+	names string
+	types []*types.TypeName
+}
+
+// promotions holds the calls of methods promoted from embedded fields, by
+// their embedding paths.
+type promotions struct {
+	sites map[token.Pos]promotionPath      // calls of a promoted method on a concrete type
+	calls map[promotedCall][]promotionPath // calls through promotion wrappers
+}
+
+// findPromotions collects the calls of promoted methods of the program.
+// Calls on a concrete type are found in the syntax of pkgs, as SSA selects
+// the embedded field and calls the method directly, other calls (through
+// interfaces or method values) go through the synthetic promotion wrappers
+// of cg. It must run before the synthetic nodes of cg are deleted.
+func findPromotions(pkgs []*packages.Package, cg *callgraph.Graph) *promotions {
+	p := &promotions{
+		sites: make(map[token.Pos]promotionPath),
+		calls: make(map[promotedCall][]promotionPath),
+	}
+
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if pkg.TypesInfo == nil {
+			return
+		}
+		for _, f := range pkg.Syntax {
+			ast.Inspect(f, func(n ast.Node) bool {
+				var call *ast.CallExpr
+				var pos token.Pos
+				switch n := n.(type) {
+				case *ast.CallExpr:
+					call, pos = n, n.Lparen
+				case *ast.GoStmt:
+					call, pos = n.Call, n.Go
+				case *ast.DeferStmt:
+					call, pos = n.Call, n.Defer
+				default:
+					return true
+				}
+				sel, ok := call.Fun.(*ast.SelectorExpr)
+				if !ok {
+					return true
+				}
+				s := pkg.TypesInfo.Selections[sel]
+				if s == nil || s.Kind() != types.MethodVal {
+					return true
+				}
+				if path := embeddingPath(s.Recv(), s.Index()); path.names != "" {
+					p.sites[pos] = path
+				}
+				return true
+			})
+		}
+	})
+
+	for fn, n := range cg.Nodes {
+		if fn == nil || !strings.HasPrefix(fn.Synthetic, "wrapper for") || fn.Signature.Recv() == nil || fn.Object() == nil {
+			continue
+		}
+		obj := fn.Object()
+		_, index, _ := types.LookupFieldOrMethod(fn.Signature.Recv().Type(), true, obj.Pkg(), obj.Name())
+		path := embeddingPath(fn.Signature.Recv().Type(), index)
+		if path.names == "" {
+			continue
+		}
+		for _, in := range n.In {
+			for _, out := range n.Out {
+				key := promotedCall{in.Site, out.Callee.Func}
+				p.calls[key] = append(p.calls[key], path)
+			}
+		}
+	}
+	return p
+}
+
+// paths returns the embedding paths of the promoted method called by edge,
+// which are several if a dynamic call resolves to the method promoted into
+// different types.
+func (p *promotions) paths(edge *callgraph.Edge) []promotionPath {
+	if p == nil || edge.Site == nil {
+		return nil
+	}
+	if paths, ok := p.calls[promotedCall{edge.Site, edge.Callee.Func}]; ok {
+		return paths
+	}
+	if path, ok := p.sites[edge.Site.Pos()]; ok && edge.Site.Common().StaticCallee() == edge.Callee.Func {
+		return []promotionPath{path}
+	}
+	return nil
+}
+
+// namedType returns the type name of t, dereferencing pointers, or nil if
+// t is not a named type.
+func namedType(t types.Type) *types.TypeName {
+	if ptr, ok := t.Underlying().(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	if named, ok := t.(*types.Named); ok {
+		return named.Obj()
+	}
+	return nil
+}
+
+// typeName returns the name of t without package, dereferencing pointers.
+func typeName(t types.Type) string {
+	if obj := namedType(t); obj != nil {
+		return obj.Name()
+	}
+	return t.String()
+}
+
+// embeddingPath returns the path of recv and of the embedded fields
+// through which the method at index of recv is promoted, with names joined
+// by dots, or a path without names if the method is declared by recv
+// itself.
+func embeddingPath(recv types.Type, index []int) promotionPath {
+	if len(index) < 2 {
+		return promotionPath{}
+	}
+	names := []string{typeName(recv)}
+	var typeNames []*types.TypeName
+	if obj := namedType(recv); obj != nil {
+		typeNames = append(typeNames, obj)
+	}
+	t := recv
+	for _, i := range index[:len(index)-1] {
+		if ptr, ok := t.Underlying().(*types.Pointer); ok {
+			t = ptr.Elem()
+		}
+		st, ok := t.Underlying().(*types.Struct)
+		if !ok || i >= st.NumFields() {
+			return promotionPath{}
+		}
+		f := st.Field(i)
+		names = append(names, f.Name())
+		if obj := namedType(f.Type()); obj != nil {
+			typeNames = append(typeNames, obj)
+		}
+		t = f.Type()
+	}
+	return promotionPath{names: strings.Join(names, "."), types: typeNames}
+}
+
+// embedsEdges returns an "embeds" edge from each type cluster to the
+// clusters of the types it embeds, directly or through embedded types
+// without cluster.
+func embedsEdges(typeClusters map[*types.TypeName][]*dotCluster) []*dotEdge {
+	var edges []*dotEdge
+	var embeds func(root *types.TypeName, t *types.TypeName, via []string, seen map[*types.TypeName]bool)
+	embeds = func(root *types.TypeName, t *types.TypeName, via []string, seen map[*types.TypeName]bool) {
+		st, ok := t.Type().Underlying().(*types.Struct)
+		if !ok {
+			return
+		}
+		for i := 0; i < st.NumFields(); i++ {
+			f := st.Field(i)
+			e := namedType(f.Type())
+			if !f.Embedded() || e == nil || seen[e] {
+				continue
+			}
+			seen[e] = true
+			to, ok := typeClusters[e]
+			if !ok {
+				embeds(root, e, append(via, e.Name()), seen)
+				continue
+			}
+			label := "embeds"
+			if len(via) > 0 {
+				label = fmt.Sprintf("embeds via %s", strings.Join(via, "."))
+			}
+			from := typeClusters[root][0]
+			edges = append(edges, &dotEdge{
+				From: from.Nodes[0],
+				To:   to[0].Nodes[0],
+				Attrs: dotAttrs{
+					"ltail":     from.String(),
+					"lhead":     to[0].String(),
+					"label":     label,
+					"style":     "dotted",
+					"arrowhead": "onormal",
+					"color":     "#8b6914",
+					"fontsize":  "10",
+					"tooltip":   fmt.Sprintf("%s %s %s", root.Name(), label, e.Name()),
+				},
+				Info: &edgeInfo{Kind: "embeds"},
+			})
+		}
+	}
+
+	roots := make([]*types.TypeName, 0, len(typeClusters))
+	for t := range typeClusters {
+		roots = append(roots, t)
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		return roots[i].Pkg().Path()+"."+roots[i].Name() < roots[j].Pkg().Path()+"."+roots[j].Name()
+	})
+	for _, t := range roots {
+		embeds(t, t, nil, map[*types.TypeName]bool{t: true})
+	}
+	return edges
+}
@@ -0,0 +1,57 @@
+package main
+
+import "sync"
+
+type counter struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (c *counter) inc() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n++
+}
+
+func produce(jobs chan<- int, n int) {
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+}
+
+func work(jobs <-chan int, results chan<- int, c *counter, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for j := range jobs {
+		c.inc()
+		results <- j * j
+	}
+}
+
+func collect(results <-chan int, done chan struct{}) {
+	sum := 0
+	for r := range results {
+		sum += r
+	}
+	println(sum)
+	close(done)
+}
+
+func main() {
+	jobs := make(chan int, 8)
+	results := make(chan int)
+	done := make(chan struct{})
+	var c counter
+	var wg sync.WaitGroup
+
+	go produce(jobs, 10)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go work(jobs, results, &c, &wg)
+	}
+	go collect(results, done)
+
+	wg.Wait()
+	close(results)
+	<-done
+}
@@ -0,0 +1,60 @@
+package main
+
+type Inf interface {
+	m()
+	n()
+}
+
+type A struct{}
+
+func (a A) m() {
+	println("A's m()")
+}
+
+func (a *A) n() {
+	println("A's n()")
+}
+
+type B struct {
+	A
+}
+
+type C struct {
+	A
+}
+
+func (c C) m() {
+	println("C's m()")
+}
+
+type D struct {
+	B
+}
+
+type F struct {
+	*C
+}
+
+type G struct {
+	F
+}
+
+func call(inf Inf) {
+	inf.m()
+	inf.n()
+}
+
+func main() {
+	d := &D{}
+	d.m()
+	d.n()
+	call(d)
+
+	g := &G{F{&C{}}}
+	g.m()
+	g.n()
+	call(g)
+
+	f := g.n
+	f()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type Number interface {
+	~int | ~float64
+}
+
+type Stringer interface {
+	String() string
+}
+
+type Celsius float64
+
+func (c Celsius) String() string {
+	return strconv.FormatFloat(float64(c), 'f', 1, 64) + "°C"
+}
+
+type ID int
+
+func (id ID) String() string {
+	return "#" + strconv.Itoa(int(id))
+}
+
+// Stack is a generic type whose methods are instantiated per element type.
+type Stack[T any] struct {
+	items []T
+}
+
+func (s *Stack[T]) Push(v T) {
+	s.items = append(s.items, v)
+}
+
+func (s *Stack[T]) Pop() (T, bool) {
+	var zero T
+	if len(s.items) == 0 {
+		return zero, false
+	}
+	v := s.items[len(s.items)-1]
+	s.items = s.items[:len(s.items)-1]
+	return v, true
+}
+
+func Map[T, U any](s []T, f func(T) U) []U {
+	r := make([]U, 0, len(s))
+	for _, v := range s {
+		r = append(r, f(v))
+	}
+	return r
+}
+
+func Sum[T Number](s []T) T {
+	var sum T
+	for _, v := range s {
+		sum += v
+	}
+	return sum
+}
+
+// Join calls String through the type parameter, which resolves to the
+// method of each type argument.
+func Join[T Stringer](s []T) string {
+	r := ""
+	for _, v := range s {
+		r += v.String() + " "
+	}
+	return r
+}
+
+func main() {
+	temps := []Celsius{21.5, 19, 23.25}
+	ids := []ID{1, 2, 3}
+
+	fmt.Println(Sum(temps), Sum(ids))
+	fmt.Println(Join(temps), Join(ids))
+	fmt.Println(Map(ids, func(id ID) string { return id.String() }))
+
+	var s Stack[ID]
+	for _, id := range ids {
+		s.Push(id)
+	}
+	s.Pop()
+
+	var names Stack[string]
+	names.Push("a")
+	names.Pop()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"go/token"
+	"go/types"
+
+	"github.com/ofabry/go-callvis/internal/pointer"
+	"golang.org/x/tools/go/ssa"
+)
+
+// funcFlow is a function value created in one function and called through
+// a dynamic call, possibly in another function.
+type funcFlow struct {
+	creator *ssa.Function       // function creating or referencing the value
+	fn      *ssa.Function       // function called through the value
+	pos     token.Pos           // where the value is created
+	site    ssa.CallInstruction // dynamic call of the value
+}
+
+// addFuncValueQueries adds a pointer query for the function value of each
+// dynamic call of funcs which is not an interface method call, returning
+// these calls.
+func addFuncValueQueries(funcs map[*ssa.Function]bool, config *pointer.Config) []ssa.CallInstruction {
+	var sites []ssa.CallInstruction
+	for fn := range funcs {
+		for _, b := range fn.Blocks {
+			for _, instr := range b.Instrs {
+				site, ok := instr.(ssa.CallInstruction)
+				if !ok {
+					continue
+				}
+				common := site.Common()
+				if common.IsInvoke() || common.StaticCallee() != nil || !pointer.CanPoint(common.Value.Type()) {
+					continue
+				}
+				config.AddQuery(common.Value)
+				sites = append(sites, site)
+			}
+		}
+	}
+	return sites
+}
+
+// funcFlows returns where the function values called at sites were created,
+// using the pointer queries added by addFuncValueQueries. Closures are
+// created by the function containing their MakeClosure, other functions by
+// the functions of funcs referring to them as a value.
+func funcFlows(prog *ssa.Program, funcs map[*ssa.Function]bool, sites []ssa.CallInstruction, result *pointer.Result) []funcFlow {
+	type origin struct {
+		creator *ssa.Function
+		pos     token.Pos
+	}
+
+	// declared functions referred to as values, by the referring functions
+	var refs map[*ssa.Function][]origin
+	var referrers = func(fn *ssa.Function) []origin {
+		if refs == nil {
+			refs = make(map[*ssa.Function][]origin)
+			for parent := range funcs {
+				for _, b := range parent.Blocks {
+					for _, instr := range b.Instrs {
+						var callee ssa.Value
+						if site, ok := instr.(ssa.CallInstruction); ok {
+							callee = site.Common().Value
+						}
+						var buf [8]*ssa.Value
+						for _, op := range instr.Operands(buf[:0]) {
+							if f, ok := (*op).(*ssa.Function); ok && *op != callee {
+								refs[f] = append(refs[f], origin{parent, instr.Pos()})
+							}
+						}
+					}
+				}
+			}
+		}
+		return refs[fn]
+	}
+
+	// the declared function of bound method wrappers and thunks
+	var declared = func(fn *ssa.Function) *ssa.Function {
+		if !isSyntheticFunc(fn) {
+			return fn
+		}
+		if obj, ok := fn.Object().(*types.Func); ok {
+			if f := prog.FuncValue(obj); f != nil {
+				return f
+			}
+		}
+		return fn
+	}
+
+	var flows []funcFlow
+	for _, site := range sites {
+		ptr, ok := result.Queries[site.Common().Value]
+		if !ok {
+			continue
+		}
+		for _, l := range ptr.PointsTo().Labels() {
+			switch v := l.Value().(type) {
+			case *ssa.MakeClosure:
+				fn := v.Fn.(*ssa.Function)
+				flows = append(flows, funcFlow{v.Parent(), declared(fn), v.Pos(), site})
+			case *ssa.Function:
+				if v.Parent() != nil {
+					// anonymous function without free variables
+					flows = append(flows, funcFlow{v.Parent(), v, v.Pos(), site})
+					continue
+				}
+				for _, o := range referrers(v) {
+					flows = append(flows, funcFlow{o.creator, declared(v), o.pos, site})
+				}
+			}
+		}
+	}
+	return flows
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// funcPkg returns the package declaring fn, which for instantiations of
+// generic functions and their closures is the package of the generic
+// function, or nil for synthetic functions shared by all packages.
+func funcPkg(fn *ssa.Function) *types.Package {
+	if fn.Pkg == nil {
+		if origin := fn.Origin(); origin != nil {
+			fn = origin
+		}
+	}
+	if fn.Pkg == nil {
+		return nil
+	}
+	return fn.Pkg.Pkg
+}
+
+// isSyntheticFunc reports whether fn has no source of its own, unlike
+// instantiations of generic functions which SSA marks synthetic too.
+func isSyntheticFunc(fn *ssa.Function) bool {
+	return fn.Synthetic != "" && fn.Origin() == nil
+}
+
+// isGenericBody reports whether fn is the body of a generic function or a
+// method of a generic type, which is never called, its instantiations are.
+func isGenericBody(fn *ssa.Function) bool {
+	return fn.Signature.TypeParams().Len() > 0 || fn.Signature.RecvTypeParams().Len() > 0
+}
+
+// funcLabel returns the name of fn relative to pkg like RelString, with
+// the type arguments of instantiations qualified by package name instead
+// of import path, e.g. Map[ID, string] or (*Stack[ID]).Push.
+func funcLabel(fn *ssa.Function, pkg *types.Package) string {
+	label := fn.RelString(pkg)
+	top := fn
+	for top.Parent() != nil {
+		top = top.Parent()
+	}
+	qualifier := func(p *types.Package) string {
+		if p == pkg {
+			return ""
+		}
+		return p.Name()
+	}
+	for _, t := range top.TypeArgs() {
+		label = strings.Replace(label, t.String(), types.TypeString(t, qualifier), -1)
+	}
+	return label
+}
+
+// genericLabel returns the name of the generic function fn relative to pkg
+// with its type parameters, e.g. Map[T, U] or (*Stack[T]).Push.
+func genericLabel(fn *ssa.Function, pkg *types.Package) string {
+	label := fn.RelString(pkg)
+	if tps := fn.Signature.TypeParams(); fn.Parent() == nil && tps.Len() > 0 {
+		names := make([]string, tps.Len())
+		for i := range names {
+			names[i] = tps.At(i).Obj().Name()
+		}
+		label += "[" + strings.Join(names, ", ") + "]"
+	}
+	return label
+}
+
+// trimRecv returns the label of a method without its receiver type, e.g.
+// Push for (*Stack[ID]).Push.
+func trimRecv(label string) string {
+	if i := strings.Index(label, ")."); i >= 0 {
+		return label[i+2:]
+	}
+	return label
+}
+
+// mergeInstances merges the nodes of the instantiations of each generic
+// function of g into one node, in place of the first instantiation, and
+// merges the edges which become parallel. labels are the labels of the
+// generic functions by the Generic of the node infos.
+func mergeInstances(g *dotGraph, labels map[string]string) {
+	merged := make(map[string]*dotNode)
+	members := make(map[string][]*dotNode)
+	g.visitNodes(func(n *dotNode, _ *dotCluster) {
+		if n.Info == nil || n.Info.Generic == "" {
+			return
+		}
+		key := n.Info.Generic
+		members[key] = append(members[key], n)
+		if _, ok := merged[key]; ok {
+			return
+		}
+		info := *n.Info
+		attrs := make(dotAttrs)
+		for k, v := range n.Attrs {
+			attrs[k] = v
+		}
+		merged[key] = &dotNode{ID: key, Attrs: attrs, Info: &info}
+	})
+	if len(merged) == 0 {
+		return
+	}
+
+	for key, m := range merged {
+		var tooltips []string
+		for _, n := range members[key] {
+			tooltips = append(tooltips, n.Attrs["tooltip"])
+		}
+		insts := "instantiations"
+		if len(members[key]) == 1 {
+			insts = "instantiation"
+		}
+		m.Attrs["label"] = fmt.Sprintf("%s\n(%d %s)", labels[key], len(members[key]), insts)
+		m.Attrs["tooltip"] = fmt.Sprintf("generic %s | instantiations:\n%s", key, strings.Join(tooltips, "\n"))
+	}
+
+	var node = func(n *dotNode) *dotNode {
+		if n.Info != nil && merged[n.Info.Generic] != nil {
+			return merged[n.Info.Generic]
+		}
+		return n
+	}
+	var rebuild = func(nodes []*dotNode) []*dotNode {
+		var l []*dotNode
+		placed := make(map[*dotNode]bool)
+		for _, n := range nodes {
+			if m := node(n); !placed[m] {
+				placed[m] = true
+				l = append(l, m)
+			}
+		}
+		return l
+	}
+	g.visitClusters(func(c, _ *dotCluster) {
+		c.Nodes = rebuild(c.Nodes)
+	})
+	g.Nodes = rebuild(g.Nodes)
+
+	var edges []*dotEdge
+	parallel := make(map[string]*dotEdge)
+	for _, e := range g.Edges {
+		e.From, e.To = node(e.From), node(e.To)
+		kind := ""
+		if e.Info != nil {
+			kind = e.Info.Kind
+		}
+		key := fmt.Sprintf("%s => %s %s %s", e.From.ID, e.To.ID, kind, e.Attrs["style"])
+		p, ok := parallel[key]
+		if !ok {
+			parallel[key] = e
+			edges = append(edges, e)
+			continue
+		}
+		if e.Info != nil && p.Info != nil {
+			p.Info.Positions = append(p.Info.Positions, e.Info.Positions...)
+		}
+		for _, line := range strings.Split(e.Attrs["tooltip"], "\n") {
+			if !strings.Contains(p.Attrs["tooltip"], line) {
+				p.Attrs["tooltip"] += "\n" + line
+			}
+		}
+	}
+	g.Edges = edges
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+const genericsSrc = `package gen
+
+type ID int
+
+func (id ID) String() string { return "id" }
+
+type Stack[T any] struct{ items []T }
+
+func (s *Stack[T]) Push(v T) { s.items = append(s.items, v) }
+
+func Map[T, U any](s []T, f func(T) U) []U {
+	r := make([]U, 0, len(s))
+	for _, v := range s {
+		r = append(r, f(v))
+	}
+	return r
+}
+
+func Const[T any](v T) func() T {
+	return func() T { return v }
+}
+
+func Plain() {}
+
+func Use() {
+	Map([]ID{1}, func(id ID) string { return id.String() })
+	Map([]int{1}, func(i int) int { return i })
+	var s Stack[ID]
+	s.Push(1)
+	var t Stack[string]
+	t.Push("a")
+	Const(ID(1))()
+	Plain()
+}
+`
+
+// buildGenerics builds genericsSrc with a function per instantiation, as
+// DoAnalysis does.
+func buildGenerics(t *testing.T) (*ssa.Package, map[string]*ssa.Function) {
+	t.Helper()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "gen.go", genericsSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, _, err := ssautil.BuildPackage(&types.Config{Importer: importer.Default()}, fset,
+		types.NewPackage("example.com/gen", "gen"), []*ast.File{f}, ssa.InstantiateGenerics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funcs := make(map[string]*ssa.Function)
+	for fn := range ssautil.AllFunctions(pkg.Prog) {
+		funcs[fn.String()] = fn
+	}
+	return pkg, funcs
+}
+
+func lookupFunc(t *testing.T, funcs map[string]*ssa.Function, name string) *ssa.Function {
+	t.Helper()
+	fn, ok := funcs[name]
+	if !ok {
+		t.Fatalf("function %s not found", name)
+	}
+	return fn
+}
+
+func TestFuncLabelInstances(t *testing.T) {
+	pkg, funcs := buildGenerics(t)
+	for _, tt := range []struct {
+		fn       string
+		inst     string
+		generic  string
+		original string
+	}{
+		{"example.com/gen.Map[example.com/gen.ID, string]", "Map[ID, string]", "Map[T, U]", "example.com/gen.Map"},
+		{"example.com/gen.Map[int, int]", "Map[int, int]", "Map[T, U]", "example.com/gen.Map"},
+		{"example.com/gen.Const[example.com/gen.ID]", "Const[ID]", "Const[T]", "example.com/gen.Const"},
+	} {
+		fn := lookupFunc(t, funcs, tt.fn)
+		if got := funcLabel(fn, pkg.Pkg); got != tt.inst {
+			t.Errorf("funcLabel(%s) = %q, want %q", tt.fn, got, tt.inst)
+		}
+		origin := fn.Origin()
+		if origin == nil || origin.String() != tt.original {
+			t.Fatalf("Origin(%s) = %v, want %s", tt.fn, origin, tt.original)
+		}
+		if got := genericLabel(origin, funcPkg(origin)); got != tt.generic {
+			t.Errorf("genericLabel(%s) = %q, want %q", origin, got, tt.generic)
+		}
+		if funcPkg(fn) != pkg.Pkg || isSyntheticFunc(fn) || isGenericBody(fn) || !isGenericBody(origin) {
+			t.Errorf("%s: instance taken for a synthetic or generic function", tt.fn)
+		}
+	}
+
+	plain := lookupFunc(t, funcs, "example.com/gen.Plain")
+	if got := funcLabel(plain, pkg.Pkg); got != "Plain" {
+		t.Errorf("funcLabel(Plain) = %q, want %q", got, "Plain")
+	}
+	if plain.Origin() != nil {
+		t.Errorf("Origin(Plain) = %v, want nil", plain.Origin())
+	}
+}
+
+func TestFuncLabelGenericReceivers(t *testing.T) {
+	pkg, funcs := buildGenerics(t)
+	for _, tt := range []struct {
+		fn   string
+		inst string
+	}{
+		{"(*example.com/gen.Stack[example.com/gen.ID]).Push", "(*Stack[ID]).Push"},
+		{"(*example.com/gen.Stack[string]).Push", "(*Stack[string]).Push"},
+	} {
+		fn := lookupFunc(t, funcs, tt.fn)
+		if got := funcLabel(fn, pkg.Pkg); got != tt.inst {
+			t.Errorf("funcLabel(%s) = %q, want %q", tt.fn, got, tt.inst)
+		}
+		if got := genericLabel(fn.Origin(), pkg.Pkg); got != "(*Stack[T]).Push" {
+			t.Errorf("genericLabel(%s) = %q, want %q", fn.Origin(), got, "(*Stack[T]).Push")
+		}
+		if got := trimRecv(funcLabel(fn, pkg.Pkg)); got != "Push" {
+			t.Errorf("trimRecv(%s) = %q, want %q", tt.inst, got, "Push")
+		}
+	}
+	if got := trimRecv("Map[ID, string]"); got != "Map[ID, string]" {
+		t.Errorf("trimRecv of a function = %q, want it unchanged", got)
+	}
+}
+
+func TestFuncLabelGenericClosures(t *testing.T) {
+	pkg, funcs := buildGenerics(t)
+	closure := lookupFunc(t, funcs, "example.com/gen.Const[example.com/gen.ID]$1")
+	if got := funcLabel(closure, pkg.Pkg); got != "Const[ID]$1" {
+		t.Errorf("funcLabel(%s) = %q, want %q", closure, got, "Const[ID]$1")
+	}
+	origin := closure.Origin()
+	if origin == nil || origin.String() != "example.com/gen.Const$1" {
+		t.Fatalf("Origin(%s) = %v, want example.com/gen.Const$1", closure, origin)
+	}
+	if got := genericLabel(origin, pkg.Pkg); got != "Const$1" {
+		t.Errorf("genericLabel(%s) = %q, want %q", origin, got, "Const$1")
+	}
+	if funcPkg(closure) != pkg.Pkg {
+		t.Errorf("funcPkg(%s) = %v, want %v", closure, funcPkg(closure), pkg.Pkg)
+	}
+}
+
+func TestMergeInstances(t *testing.T) {
+	var node = func(id, generic string) *dotNode {
+		return &dotNode{
+			ID:    id,
+			Attrs: dotAttrs{"label": id, "tooltip": id},
+			Info:  &nodeInfo{Generic: generic},
+		}
+	}
+	var edge = func(from, to *dotNode, pos string) *dotEdge {
+		return &dotEdge{
+			From:  from,
+			To:    to,
+			Attrs: dotAttrs{"tooltip": "at " + pos},
+			Info:  &edgeInfo{Kind: "call", Positions: []string{pos}},
+		}
+	}
+	caller := node("gen.main", "")
+	mapID := node("gen.Map[gen.ID, string]", "gen.Map")
+	mapInt := node("gen.Map[int, int]", "gen.Map")
+	pushID := node("(*gen.Stack[gen.ID]).Push", "(*gen.Stack[T]).Push")
+
+	cluster := NewDotCluster("focus")
+	cluster.Nodes = []*dotNode{caller, mapID, mapInt}
+	g := &dotGraph{
+		Cluster: cluster,
+		Nodes:   []*dotNode{pushID},
+		Edges: []*dotEdge{
+			edge(caller, mapID, "gen.go:30"),
+			edge(caller, mapInt, "gen.go:31"),
+			edge(caller, pushID, "gen.go:33"),
+		},
+	}
+	mergeInstances(g, map[string]string{
+		"gen.Map":              "Map[T, U]",
+		"(*gen.Stack[T]).Push": "(*Stack[T]).Push",
+	})
+
+	if len(cluster.Nodes) != 2 || cluster.Nodes[0] != caller || cluster.Nodes[1].ID != "gen.Map" {
+		t.Fatalf("cluster nodes = %v, want [gen.main gen.Map]", cluster.Nodes)
+	}
+	merged := cluster.Nodes[1]
+	if got, want := merged.Attrs["label"], "Map[T, U]\n(2 instantiations)"; got != want {
+		t.Errorf("label = %q, want %q", got, want)
+	}
+	if got, want := merged.Attrs["tooltip"], "generic gen.Map | instantiations:\ngen.Map[gen.ID, string]\ngen.Map[int, int]"; got != want {
+		t.Errorf("tooltip = %q, want %q", got, want)
+	}
+	if len(g.Nodes) != 1 || g.Nodes[0].Attrs["label"] != "(*Stack[T]).Push\n(1 instantiation)" {
+		t.Errorf("top level nodes = %v, want the merged Push", g.Nodes)
+	}
+
+	if len(g.Edges) != 2 {
+		t.Fatalf("got %d edges, want the calls of Map merged into one", len(g.Edges))
+	}
+	e := g.Edges[0]
+	if e.From != caller || e.To != merged {
+		t.Errorf("edge = %s -> %s, want gen.main -> gen.Map", e.From, e.To)
+	}
+	if len(e.Info.Positions) != 2 || e.Attrs["tooltip"] != "at gen.go:30\nat gen.go:31" {
+		t.Errorf("merged edge has positions %v and tooltip %q, want both calls", e.Info.Positions, e.Attrs["tooltip"])
+	}
+}
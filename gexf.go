@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type gexfNode struct {
+	ID     string      `xml:"id,attr"`
+	Label  string      `xml:"label,attr"`
+	Values []gexfValue `xml:"attvalues>attvalue"`
+}
+
+type gexfEdge struct {
+	ID     string      `xml:"id,attr"`
+	Source string      `xml:"source,attr"`
+	Target string      `xml:"target,attr"`
+	Weight int         `xml:"weight,attr,omitempty"`
+	Values []gexfValue `xml:"attvalues>attvalue"`
+}
+
+type gexfDoc struct {
+	XMLName xml.Name `xml:"gexf"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	Version string   `xml:"version,attr"`
+	Meta    struct {
+		Creator     string `xml:"creator"`
+		Description string `xml:"description"`
+	} `xml:"meta"`
+	Graph struct {
+		DefaultEdgeType string           `xml:"defaultedgetype,attr"`
+		Mode            string           `xml:"mode,attr"`
+		Attributes      []gexfAttributes `xml:"attributes"`
+		Nodes           []gexfNode       `xml:"nodes>node"`
+		Edges           []gexfEdge       `xml:"edges>edge"`
+	} `xml:"graph"`
+}
+
+func gexfAttrs(class string, keys []graphKey) gexfAttributes {
+	a := gexfAttributes{Class: class}
+	for _, k := range keys {
+		typ := k.Type
+		if typ == "int" {
+			typ = "integer"
+		}
+		a.Attributes = append(a.Attributes, gexfAttribute{ID: k.Name, Title: k.Name, Type: typ})
+	}
+	return a
+}
+
+func gexfValues(keys []graphKey, values map[string]interface{}) []gexfValue {
+	var l []gexfValue
+	for _, k := range keys {
+		l = append(l, gexfValue{For: k.Name, Value: fmt.Sprint(values[k.Name])})
+	}
+	return l
+}
+
+// WriteGEXF writes the graph in GEXF 1.3 for Gephi. Node and edge data are
+// typed GEXF attributes and edges are weighted by their number of calls.
+func (g *dotGraph) WriteGEXF(w io.Writer) error {
+	doc := &gexfDoc{XMLNS: "http://gexf.net/1.3", Version: "1.3"}
+	doc.Meta.Creator = "go-callvis"
+	doc.Meta.Description = g.Title
+	doc.Graph.DefaultEdgeType = "directed"
+	doc.Graph.Mode = "static"
+	doc.Graph.Attributes = []gexfAttributes{
+		gexfAttrs("node", nodeKeys),
+		gexfAttrs("edge", edgeKeys),
+	}
+
+	g.visitNodes(func(n *dotNode, c *dotCluster) {
+		values := nodeValues(n, c)
+		doc.Graph.Nodes = append(doc.Graph.Nodes, gexfNode{
+			ID:     n.ID,
+			Label:  fmt.Sprint(values["label"]),
+			Values: gexfValues(nodeKeys, values),
+		})
+	})
+	for i, e := range g.sortedEdges() {
+		values := edgeValues(e)
+		doc.Graph.Edges = append(doc.Graph.Edges, gexfEdge{
+			ID:     fmt.Sprint(i),
+			Source: e.From.ID,
+			Target: e.To.ID,
+			Weight: values["calls"].(int),
+			Values: gexfValues(edgeKeys, values),
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -1,9 +1,19 @@
 module github.com/ofabry/go-callvis
 
-go 1.12
+go 1.26.0
 
 require (
 	github.com/goccy/go-graphviz v0.0.6
+	github.com/google/pprof v0.0.0-20200229191704-1ebb73c60ed3
 	github.com/pkg/browser v0.0.0-20180916011732-0a3d74bf9ce4
-	golang.org/x/tools v0.0.0-20200305224536-de023d59a5d1
+	golang.org/x/tools v0.50.0
+)
+
+require (
+	github.com/fogleman/gg v1.3.0 // indirect
+	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	golang.org/x/image v0.0.0-20200119044424-58c23975cae1 // indirect
+	golang.org/x/mod v0.41.0 // indirect
+	golang.org/x/sync v0.23.0 // indirect
 )
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// graphKey is a typed node or edge attribute of the graph exchange
+// formats (GraphML, GEXF and Cytoscape.js).
+type graphKey struct {
+	Name string
+	Type string // string, int or boolean
+}
+
+var nodeKeys = []graphKey{
+	{"label", "string"},
+	{"package", "string"},
+	{"module", "string"},
+	{"type", "string"},
+	{"file", "string"},
+	{"line", "int"},
+	{"exported", "boolean"},
+	{"std", "boolean"},
+	{"focused", "boolean"},
+	{"lang", "string"},
+	{"kind", "string"},
+	{"cluster", "string"},
+}
+
+var edgeKeys = []graphKey{
+	{"kind", "string"},
+	{"dynamic", "boolean"},
+	{"calls", "int"},
+	{"positions", "string"},
+	{"label", "string"},
+}
+
+// nodeValues returns the nodeKeys values of n in cluster c.
+func nodeValues(n *dotNode, c *dotCluster) map[string]interface{} {
+	info := n.Info
+	if info == nil {
+		info = &nodeInfo{}
+	}
+	label := n.Attrs["label"]
+	if label == "" {
+		label = n.ID
+	}
+	v := map[string]interface{}{
+		"label":    label,
+		"package":  info.Package,
+		"module":   info.Module,
+		"type":     info.Type,
+		"file":     info.File,
+		"line":     info.Line,
+		"exported": info.Exported,
+		"std":      info.Std,
+		"focused":  info.Focused,
+		"lang":     info.Lang,
+		"kind":     info.Kind,
+		"cluster":  "",
+	}
+	if c != nil {
+		v["cluster"] = c.ID
+	}
+	return v
+}
+
+// edgeValues returns the edgeKeys values of e. Call site positions are
+// joined by spaces.
+func edgeValues(e *dotEdge) map[string]interface{} {
+	info := e.Info
+	if info == nil {
+		info = &edgeInfo{Kind: "call"}
+	}
+	return map[string]interface{}{
+		"kind":      info.Kind,
+		"dynamic":   info.Dynamic,
+		"calls":     len(info.Positions),
+		"positions": strings.Join(info.Positions, " "),
+		"label":     e.Attrs["label"],
+	}
+}
+
+type graphmlKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphmlData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphmlNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphmlData `xml:"data"`
+}
+
+type graphmlEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphmlData `xml:"data"`
+}
+
+type graphmlDoc struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphmlKey `xml:"key"`
+	Graph   struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphmlNode `xml:"node"`
+		Edges       []graphmlEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+func graphmlValues(keys []graphKey, prefix string, values map[string]interface{}) []graphmlData {
+	var data []graphmlData
+	for _, k := range keys {
+		data = append(data, graphmlData{Key: prefix + k.Name, Value: fmt.Sprint(values[k.Name])})
+	}
+	return data
+}
+
+// WriteGraphML writes the graph in GraphML, e.g. for yEd or Gephi. Node
+// and edge data are typed GraphML attributes, clusters are kept in the
+// cluster attribute of nodes.
+func (g *dotGraph) WriteGraphML(w io.Writer) error {
+	doc := &graphmlDoc{XMLNS: "http://graphml.graphdrawing.org/xmlns"}
+	for _, k := range nodeKeys {
+		doc.Keys = append(doc.Keys, graphmlKey{ID: "n_" + k.Name, For: "node", Name: k.Name, Type: k.Type})
+	}
+	for _, k := range edgeKeys {
+		doc.Keys = append(doc.Keys, graphmlKey{ID: "e_" + k.Name, For: "edge", Name: k.Name, Type: k.Type})
+	}
+	doc.Graph.ID = g.Title
+	doc.Graph.EdgeDefault = "directed"
+
+	g.visitNodes(func(n *dotNode, c *dotCluster) {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphmlNode{
+			ID:   n.ID,
+			Data: graphmlValues(nodeKeys, "n_", nodeValues(n, c)),
+		})
+	})
+	for i, e := range g.sortedEdges() {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphmlEdge{
+			ID:     fmt.Sprintf("e%d", i),
+			Source: e.From.ID,
+			Target: e.To.ID,
+			Data:   graphmlValues(edgeKeys, "e_", edgeValues(e)),
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"go/build"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// pkgModule is the module a package belongs to.
+type pkgModule struct {
+	Path    string
+	Version string
+}
+
+// packageModules returns the module of each loaded package by import path.
+// Standard library packages belong to module "std", packages outside of
+// any module (GOPATH mode) are omitted.
+func packageModules(initial []*packages.Package) map[string]*pkgModule {
+	goroot := filepath.Join(build.Default.GOROOT, "src") + string(filepath.Separator)
+	modules := make(map[string]*pkgModule)
+	packages.Visit(initial, nil, func(p *packages.Package) {
+		switch {
+		case p.Module != nil:
+			m := &pkgModule{Path: p.Module.Path, Version: p.Module.Version}
+			if r := p.Module.Replace; r != nil && r.Version != "" {
+				m.Version = r.Version
+			}
+			modules[p.PkgPath] = m
+		case len(p.GoFiles) > 0 && strings.HasPrefix(p.GoFiles[0], goroot):
+			modules[p.PkgPath] = &pkgModule{Path: "std"}
+		}
+	})
+	return modules
+}
+
+// moduleCluster returns the cluster of module m in c.
+func moduleCluster(c *dotCluster, m *pkgModule, std bool) *dotCluster {
+	key := "module:" + m.Path
+	if _, ok := c.Clusters[key]; !ok {
+		tooltip := fmt.Sprintf("module: %s", m.Path)
+		if m.Version != "" {
+			tooltip += "@" + m.Version
+		}
+		c.Clusters[key] = &dotCluster{
+			ID:       key,
+			Kind:     "module",
+			Clusters: make(map[string]*dotCluster),
+			Attrs: dotAttrs{
+				"penwidth":  "1.2",
+				"fontsize":  "18",
+				"label":     m.Path,
+				"labeljust": "l",
+				"style":     "filled",
+				"fillcolor": "#ece8f5",
+				"fontname":  "Tahoma bold",
+				"tooltip":   tooltip,
+			},
+		}
+		if std {
+			c.Clusters[key].Attrs["fillcolor"] = "#d8f0d8"
+		}
+	}
+	return c.Clusters[key]
+}
+
+// dirClusters returns the innermost of the nested clusters of the
+// directories in rel, an import path relative to base, creating them in c.
+func dirClusters(c *dotCluster, base, rel string, std bool) *dotCluster {
+	if rel == "" {
+		return c
+	}
+	for _, elem := range strings.Split(rel, "/") {
+		base = path.Join(base, elem)
+		key := "dir:" + base
+		if _, ok := c.Clusters[key]; !ok {
+			c.Clusters[key] = &dotCluster{
+				ID:       key,
+				Kind:     "dir",
+				Clusters: make(map[string]*dotCluster),
+				Attrs: dotAttrs{
+					"penwidth":  "0.6",
+					"fontsize":  "16",
+					"label":     elem,
+					"labeljust": "l",
+					"style":     "rounded,filled",
+					"fillcolor": "#f4f4ec",
+					"tooltip":   fmt.Sprintf("directory: %s", base),
+				},
+			}
+			if std {
+				c.Clusters[key].Attrs["fillcolor"] = "#eaf7ea"
+			}
+		}
+		c = c.Clusters[key]
+	}
+	return c
+}
+
+// fileCluster returns the cluster of source file filename in c.
+func fileCluster(c *dotCluster, filename string, std bool) *dotCluster {
+	key := "file:" + filename
+	if _, ok := c.Clusters[key]; !ok {
+		c.Clusters[key] = &dotCluster{
+			ID:       key,
+			Kind:     "file",
+			Clusters: make(map[string]*dotCluster),
+			Attrs: dotAttrs{
+				"penwidth":  "0.5",
+				"fontsize":  "14",
+				"fontcolor": "#444444",
+				"label":     filepath.Base(filename),
+				"labelloc":  "b",
+				"style":     "dashed,filled",
+				"fillcolor": "white",
+				"tooltip":   fmt.Sprintf("file: %s", filename),
+			},
+		}
+		if std {
+			c.Clusters[key].Attrs["fillcolor"] = "#f4fbf4"
+		}
+	}
+	return c.Clusters[key]
+}
+
+// compactDirs merges chains of directory clusters without functions of
+// their own, such that github.com/user/repo is one cluster instead of three.
+func compactDirs(c *dotCluster) {
+	for key, sub := range c.Clusters {
+		for sub.Kind == "dir" && len(sub.Nodes) == 0 && len(sub.Clusters) == 1 {
+			var only *dotCluster
+			for _, only = range sub.Clusters {
+			}
+			if only.Kind != "dir" {
+				break
+			}
+			only.Attrs["label"] = sub.Attrs["label"] + "/" + only.Attrs["label"]
+			sub = only
+		}
+		c.Clusters[key] = sub
+		compactDirs(sub)
+	}
+}
+
+// moduleName returns the module path of m, or "" if m is nil.
+func moduleName(m *pkgModule) string {
+	if m == nil {
+		return ""
+	}
+	return m.Path
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"log"
+	"mime"
 	"net/http"
 	"strings"
 )
@@ -36,18 +38,44 @@ func handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	output, err := Analysis.Render()
+	dotg, err := Analysis.Render()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	var buf bytes.Buffer
+	if gw, ok := graphWriters[r.Form.Get("format")]; ok {
+		log.Printf("writing %s output..\n", r.Form.Get("format"))
+		if err := gw.write(dotg, &buf); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ctype := mime.TypeByExtension("." + gw.ext)
+		if ctype == "" {
+			ctype = "text/plain; charset=utf-8"
+		}
+		w.Header().Set("Content-Type", ctype)
+		buf.WriteTo(w)
+		return
+	}
+
+	if err := dotg.WriteDot(&buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	output := buf.Bytes()
+
 	if r.Form.Get("format") == "dot" {
 		log.Println("writing dot output..")
 		fmt.Fprint(w, string(output))
 		return
 	}
 
+	if summary := cgoFailures.Summary(); summary != "" {
+		log.Print(summary)
+	}
+
 	log.Printf("converting dot to %s..\n", *outputFormat)
 
 	img, err = dotToImage("", *outputFormat, output)
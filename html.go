@@ -0,0 +1,525 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"strings"
+)
+
+type htmlCluster struct {
+	ID      string `json:"id"`
+	Label   string `json:"label"`
+	Parent  string `json:"parent,omitempty"`
+	Fill    string `json:"fill,omitempty"`
+	Tooltip string `json:"tooltip,omitempty"`
+}
+
+type htmlNode struct {
+	ID      string `json:"id"`
+	Label   string `json:"label"`
+	Parent  string `json:"parent,omitempty"`
+	Fill    string `json:"fill,omitempty"`
+	Border  string `json:"border"` // bold, normal, dotted or dashed
+	Shape   string `json:"shape,omitempty"`
+	Tooltip string `json:"tooltip,omitempty"`
+	URL     string `json:"url,omitempty"` // source of the function
+}
+
+type htmlEdge struct {
+	Source  string `json:"source"`
+	Target  string `json:"target"`
+	Color   string `json:"color,omitempty"`
+	Dashed  bool   `json:"dashed,omitempty"`
+	Kind    string `json:"kind,omitempty"` // go or defer
+	Label   string `json:"label,omitempty"`
+	Tooltip string `json:"tooltip,omitempty"`
+}
+
+type htmlGraph struct {
+	Title    string        `json:"title"`
+	Warning  string        `json:"warning,omitempty"`
+	Rankdir  string        `json:"rankdir"`
+	Clusters []htmlCluster `json:"clusters"`
+	Nodes    []htmlNode    `json:"nodes"`
+	Edges    []htmlEdge    `json:"edges"`
+}
+
+func (g *dotGraph) htmlGraph() *htmlGraph {
+	hg := &htmlGraph{
+		Title:   g.Title,
+		Warning: g.Warning,
+		Rankdir: g.Options["rankdir"],
+	}
+	g.visitClusters(func(c, parent *dotCluster) {
+		// the root cluster is only drawn when it is labelled by focus
+		if parent == nil && c == g.Cluster && c.Attrs["label"] == "" {
+			return
+		}
+		hc := htmlCluster{
+			ID:      c.String(),
+			Label:   c.Attrs["label"],
+			Fill:    cssColor(c.Attrs["fillcolor"]),
+			Tooltip: c.Attrs["tooltip"],
+		}
+		if hc.Fill == "" {
+			hc.Fill = cssColor(c.Attrs["bgcolor"])
+		}
+		if parent != nil && !(parent == g.Cluster && parent.Attrs["label"] == "") {
+			hc.Parent = parent.String()
+		}
+		hg.Clusters = append(hg.Clusters, hc)
+	})
+	g.visitNodes(func(n *dotNode, c *dotCluster) {
+		hn := htmlNode{
+			ID:      n.ID,
+			Label:   n.Attrs["label"],
+			Fill:    cssColor(n.Attrs["fillcolor"]),
+			Border:  "normal",
+			Shape:   n.Attrs["shape"],
+			Tooltip: n.Attrs["tooltip"],
+			URL:     n.Attrs["URL"],
+		}
+		if hn.Label == "" {
+			hn.Label = n.ID
+		}
+		switch s := n.Attrs["style"]; {
+		case strings.Contains(s, "dotted"):
+			hn.Border = "dotted"
+		case strings.Contains(s, "dashed"):
+			hn.Border = "dashed"
+		case n.Attrs["penwidth"] == "1.5":
+			hn.Border = "bold"
+		}
+		if c != nil && !(c == g.Cluster && c.Attrs["label"] == "") {
+			hn.Parent = c.String()
+		}
+		hg.Nodes = append(hg.Nodes, hn)
+	})
+	for _, e := range g.sortedEdges() {
+		hg.Edges = append(hg.Edges, htmlEdge{
+			Source:  e.From.ID,
+			Target:  e.To.ID,
+			Color:   cssColor(e.Attrs["color"]),
+			Dashed:  e.dashed(),
+			Kind:    e.callKind(),
+			Label:   e.Attrs["label"],
+			Tooltip: e.Attrs["tooltip"],
+		})
+	}
+	return hg
+}
+
+// WriteHTML writes a standalone HTML report which lays out and draws the
+// graph in the browser. Clusters can be collapsed into single nodes, nodes
+// can be searched and clicking a node shows its callers and callees.
+func (g *dotGraph) WriteHTML(w io.Writer) error {
+	t, err := template.New("html").Parse(tmplHTML)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, g.htmlGraph())
+}
+
+const tmplHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>go-callvis: {{.Title}}</title>
+<style>
+body { margin: 0; font-family: Verdana, sans-serif; font-size: 12px; background: lightgray; }
+#bar { position: fixed; top: 0; left: 0; right: 0; height: 34px; padding: 4px 8px; box-sizing: border-box; background: #f4f4f4; border-bottom: 1px solid #aaa; display: flex; gap: 8px; align-items: center; z-index: 2; }
+#bar .title { font-weight: bold; margin-right: 12px; }
+#warning { background: #ffcc66; padding: 2px 6px; }
+#panel { position: fixed; top: 34px; right: 0; bottom: 0; width: 300px; overflow: auto; background: #fafafa; border-left: 1px solid #aaa; padding: 8px; box-sizing: border-box; display: none; z-index: 2; }
+#panel h3 { margin: 4px 0; font-size: 13px; word-break: break-all; }
+#panel pre { white-space: pre-wrap; word-break: break-all; font-size: 11px; }
+#panel a { cursor: pointer; color: #0645ad; display: block; word-break: break-all; }
+#view { position: fixed; top: 34px; left: 0; right: 0; bottom: 0; }
+svg { width: 100%; height: 100%; cursor: grab; }
+.cluster-label { cursor: pointer; font-weight: bold; font-family: Tahoma, sans-serif; }
+.node { cursor: pointer; }
+.dim { opacity: 0.15; }
+.match rect, .match ellipse { stroke: red; stroke-width: 3px; }
+.selected rect, .selected ellipse { stroke: #0645ad; stroke-width: 3px; }
+</style>
+</head>
+<body>
+<div id="bar">
+  <span class="title">{{.Title}}</span>
+  {{if .Warning}}<span id="warning">&#9888; {{.Warning}}</span>{{end}}
+  <input id="search" type="search" placeholder="search functions" size="30">
+  <button id="collapse">collapse all</button>
+  <button id="expand">expand all</button>
+  <button id="fit">fit</button>
+</div>
+<div id="view"><svg id="svg" xmlns="http://www.w3.org/2000/svg">
+  <defs>
+    <marker id="m-call" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto-start-reverse"><path d="M0,0 L10,5 L0,10 z" fill="context-stroke"/></marker>
+    <marker id="m-go" viewBox="0 0 20 10" refX="20" refY="5" markerWidth="16" markerHeight="8" orient="auto"><path d="M0,0 L10,5 L0,10 z" fill="context-stroke"/><circle cx="15" cy="5" r="4" fill="white" stroke="context-stroke"/></marker>
+    <marker id="m-defer" viewBox="0 0 22 10" refX="22" refY="5" markerWidth="18" markerHeight="8" orient="auto"><path d="M0,0 L10,5 L0,10 z" fill="context-stroke"/><path d="M11,5 L16,1 L21,5 L16,9 z" fill="white" stroke="context-stroke"/></marker>
+  </defs>
+  <g id="scene"></g>
+</svg></div>
+<div id="panel"></div>
+<script>
+var G = {{.}};
+var SVGNS = "http://www.w3.org/2000/svg";
+var NODE_H = 26, GAP = 10, PAD = 8, HEAD = 22;
+
+var clusters = {}, nodes = {}, collapsed = {};
+(G.clusters || []).forEach(function (c) { c.children = []; c.nodes = []; clusters[c.id] = c; });
+(G.clusters || []).forEach(function (c) { if (c.parent) clusters[c.parent].children.push(c.id); });
+(G.nodes || []).forEach(function (n) { nodes[n.id] = n; if (n.parent) clusters[n.parent].nodes.push(n.id); });
+var edges = G.edges || [];
+var horizontal = G.rankdir !== "TB" && G.rankdir !== "BT";
+var reversed = G.rankdir === "RL" || G.rankdir === "BT";
+
+var measure = document.createElementNS(SVGNS, "text");
+document.getElementById("scene").appendChild(measure);
+function textWidth(s) { measure.textContent = s; return measure.getComputedTextLength(); }
+
+// owner returns the visible item of node id: the outermost collapsed
+// cluster containing it, or the node itself.
+function owner(id) {
+  var own = id, p = nodes[id].parent;
+  while (p) { if (collapsed[p]) { own = p; } p = clusters[p].parent; }
+  return own;
+}
+
+function countNodes(cid) {
+  var c = clusters[cid], n = c.nodes.length;
+  c.children.forEach(function (k) { n += countNodes(k); });
+  return n;
+}
+
+// view builds the visible graph with collapsed clusters as single items
+// and merged, counted edges between them.
+function view() {
+  var items = {}, list = [], vedges = {}, elist = [];
+  Object.keys(nodes).forEach(function (id) {
+    var o = owner(id);
+    if (!items[o]) {
+      var it;
+      if (clusters[o]) {
+        var c = clusters[o];
+        it = { id: o, label: (c.label || o) + " (" + countNodes(o) + ")", parent: c.parent, fill: c.fill, border: "bold", cluster: true, tooltip: c.tooltip, members: [] };
+      } else {
+        var n = nodes[id];
+        it = { id: id, label: n.label, parent: n.parent, fill: n.fill, border: n.border, shape: n.shape, tooltip: n.tooltip, url: n.url, members: [] };
+      }
+      items[o] = it;
+      list.push(it);
+    }
+    items[o].members.push(id);
+  });
+  edges.forEach(function (e) {
+    var a = owner(e.source), b = owner(e.target);
+    if (a === b && clusters[a]) { return; }
+    var key = a + "\u0000" + b;
+    if (!vedges[key]) {
+      vedges[key] = { source: a, target: b, color: e.color, dashed: e.dashed, kind: e.kind, label: e.label, tooltip: e.tooltip, count: 0 };
+      elist.push(vedges[key]);
+    } else if (vedges[key].tooltip !== e.tooltip) {
+      vedges[key].tooltip += "\n" + e.tooltip;
+    }
+    vedges[key].count++;
+  });
+  elist.forEach(function (e) { if (e.count > 1 && (clusters[e.source] || clusters[e.target])) { e.label = (e.label ? e.label + " " : "") + "x" + e.count; } });
+  return { items: items, list: list, edges: elist };
+}
+
+// rank assigns layers by longest path over edges which are not back edges
+// of a depth first search.
+function rank(v) {
+  var out = {}, indeg = {}, state = {}, back = {}, r = {};
+  v.list.forEach(function (it) { out[it.id] = []; indeg[it.id] = 0; });
+  v.edges.forEach(function (e, i) { out[e.source].push(i); });
+  function dfs(id) {
+    state[id] = 1;
+    out[id].forEach(function (i) {
+      var t = v.edges[i].target;
+      if (state[t] === 1) { back[i] = true; } else if (!state[t]) { dfs(t); }
+    });
+    state[id] = 2;
+  }
+  v.list.forEach(function (it) { if (!state[it.id]) { dfs(it.id); } });
+  v.edges.forEach(function (e, i) { if (!back[i] && e.source !== e.target) { indeg[e.target]++; } });
+  var queue = v.list.filter(function (it) { return indeg[it.id] === 0; }).map(function (it) { return it.id; });
+  queue.forEach(function (id) { r[id] = 0; });
+  while (queue.length) {
+    var id = queue.shift();
+    out[id].forEach(function (i) {
+      var t = v.edges[i].target;
+      if (back[i] || t === id) { return; }
+      r[t] = Math.max(r[t] || 0, r[id] + 1);
+      if (--indeg[t] === 0) { queue.push(t); }
+    });
+  }
+  return r;
+}
+
+// layout places items in columns by rank and stacks every cluster in its
+// own lane, so cluster boxes never overlap.
+function layout(v) {
+  var r = rank(v), maxW = 60;
+  v.list.forEach(function (it) { it.w = Math.min(textWidth(it.label) + 24, 320); maxW = Math.max(maxW, it.w); });
+  var depth = {};
+  function height(cid) {
+    var h = 0;
+    clusters[cid].children.forEach(function (k) { if (!collapsed[k]) { h = Math.max(h, height(k) + 1); } });
+    depth[cid] = h;
+    return h;
+  }
+  var roots = Object.keys(clusters).filter(function (k) { return !clusters[k].parent; });
+  var levels = 0;
+  roots.forEach(function (k) { levels = Math.max(levels, height(k) + 1); });
+  var nodeL = horizontal ? NODE_H : maxW, nodeR = horizontal ? maxW : NODE_H;
+  var step = nodeR + (horizontal ? 60 : 40) + 2 * PAD * levels;
+  var boxes = [];
+  function place(direct, subs, l0) {
+    var byRank = {}, l = l0, rmin = Infinity, rmax = -Infinity;
+    direct.forEach(function (it) { (byRank[r[it.id]] = byRank[r[it.id]] || []).push(it); });
+    var rows = 0;
+    Object.keys(byRank).forEach(function (k) {
+      byRank[k].sort(function (a, b) { return a.label < b.label ? -1 : 1; });
+      byRank[k].forEach(function (it, i) {
+        it.a = r[it.id] * step;
+        it.b = l + i * (nodeL + GAP);
+        rmin = Math.min(rmin, r[it.id]);
+        rmax = Math.max(rmax, r[it.id]);
+      });
+      rows = Math.max(rows, byRank[k].length);
+    });
+    l += rows * (nodeL + GAP);
+    subs.forEach(function (cid) {
+      var box = cluster(cid, l);
+      if (box) {
+        l = box.l1 + GAP;
+        rmin = Math.min(rmin, box.rmin);
+        rmax = Math.max(rmax, box.rmax);
+      }
+    });
+    return { l: l, rmin: rmin, rmax: rmax };
+  }
+  function cluster(cid, l0) {
+    var direct = v.list.filter(function (it) { return it.parent === cid; });
+    var subs = clusters[cid].children.filter(function (k) { return !collapsed[k]; });
+    if (!direct.length && !subs.some(function (k) { return countNodes(k) > 0; })) { return null; }
+    var p = place(direct, subs, l0 + HEAD);
+    if (p.rmin === Infinity) { return null; }
+    var pad = PAD * (depth[cid] + 1);
+    var box = { id: cid, a0: p.rmin * step - pad, a1: p.rmax * step + nodeR + pad, l0: l0, l1: p.l + PAD, rmin: p.rmin, rmax: p.rmax };
+    boxes.push(box);
+    return box;
+  }
+  var top = v.list.filter(function (it) { return !it.parent; });
+  place(top, roots.filter(function (k) { return !collapsed[k]; }), 0);
+  boxes.reverse();
+  return { boxes: boxes, nodeR: nodeR, nodeL: nodeL };
+}
+
+function xy(a, b) {
+  if (reversed) { a = -a; }
+  return horizontal ? [a, b] : [b, a];
+}
+
+function el(name, attrs, parent) {
+  var e = document.createElementNS(SVGNS, name);
+  Object.keys(attrs).forEach(function (k) { e.setAttribute(k, attrs[k]); });
+  if (parent) { parent.appendChild(e); }
+  return e;
+}
+
+var scene = document.getElementById("scene"), current = null, selected = null;
+
+function render() {
+  while (scene.firstChild) { scene.removeChild(scene.firstChild); }
+  scene.appendChild(measure);
+  var v = view(), lay = layout(v);
+  current = v;
+  lay.boxes.forEach(function (box) {
+    var c = clusters[box.id], p0 = xy(box.a0, box.l0), p1 = xy(box.a1, box.l1);
+    var g = el("g", { "class": "cluster" }, scene);
+    el("rect", { x: Math.min(p0[0], p1[0]), y: Math.min(p0[1], p1[1]), width: Math.abs(p1[0] - p0[0]), height: Math.abs(p1[1] - p0[1]), rx: 4, fill: c.fill || "white", stroke: "#555", "stroke-width": 0.8 }, g);
+    var t = el("text", { x: Math.min(p0[0], p1[0]) + 6, y: Math.min(p0[1], p1[1]) + 15, "class": "cluster-label" }, g);
+    t.textContent = "▾ " + (c.label || "");
+    el("title", {}, t).textContent = (c.tooltip || c.label) + " (click to collapse)";
+    t.addEventListener("click", function (ev) { ev.stopPropagation(); collapsed[box.id] = true; render(); });
+  });
+  var pos = {};
+  v.list.forEach(function (it) {
+    var p = xy(it.a, it.b), w = horizontal ? it.w : lay.nodeL, h = NODE_H;
+    pos[it.id] = { x: p[0], y: p[1], w: w, h: h };
+    var g = el("g", { "class": "node", "data-id": it.id }, scene);
+    it.g = g;
+    var style = { fill: it.fill || "honeydew", stroke: "black", "stroke-width": it.border === "bold" ? 1.5 : 0.7 };
+    if (it.border === "dotted") { style["stroke-dasharray"] = "2 2"; }
+    if (it.border === "dashed") { style["stroke-dasharray"] = "5 3"; }
+    if (it.shape === "ellipse") {
+      style.cx = p[0] + w / 2; style.cy = p[1] + h / 2; style.rx = w / 2; style.ry = h / 2;
+      el("ellipse", style, g);
+    } else {
+      style.x = p[0]; style.y = p[1]; style.width = w; style.height = h; style.rx = 6;
+      if (it.cluster) { style["stroke-width"] = 2; style.rx = 2; }
+      el("rect", style, g);
+    }
+    var t = el("text", { x: p[0] + w / 2, y: p[1] + h / 2 + 4, "text-anchor": "middle" }, g);
+    t.textContent = it.label.split("\n").join(" ");
+    el("title", {}, g).textContent = it.cluster ? it.tooltip + " (click to expand)" : it.tooltip;
+    g.addEventListener("click", function (ev) {
+      ev.stopPropagation();
+      if (it.cluster) { delete collapsed[it.id]; render(); } else { select(it.id); }
+    });
+  });
+  v.edges.forEach(function (e) {
+    var s = pos[e.source], t = pos[e.target], x1, y1, x2, y2, d;
+    if (horizontal) {
+      var fwd = reversed ? t.x < s.x : t.x > s.x;
+      x1 = reversed ? s.x : s.x + s.w; y1 = s.y + s.h / 2;
+      x2 = reversed ? t.x + t.w : t.x; y2 = t.y + t.h / 2;
+      var dx = fwd ? Math.max(40, Math.abs(x2 - x1) / 2) : 80, sg = reversed ? -1 : 1;
+      d = "M" + x1 + "," + y1 + " C" + (x1 + sg * dx) + "," + y1 + " " + (x2 - sg * dx) + "," + y2 + " " + x2 + "," + y2;
+    } else {
+      var down = reversed ? t.y < s.y : t.y > s.y;
+      x1 = s.x + s.w / 2; y1 = reversed ? s.y : s.y + s.h;
+      x2 = t.x + t.w / 2; y2 = reversed ? t.y + t.h : t.y;
+      var dy = down ? Math.max(30, Math.abs(y2 - y1) / 2) : 60, sv = reversed ? -1 : 1;
+      d = "M" + x1 + "," + y1 + " C" + x1 + "," + (y1 + sv * dy) + " " + x2 + "," + (y2 - sv * dy) + " " + x2 + "," + y2;
+    }
+    var g = el("g", { "class": "edge" }, scene);
+    e.g = g;
+    var attrs = { d: d, fill: "none", stroke: e.color || "black", "stroke-width": e.count > 1 ? Math.min(1 + Math.log(e.count), 4) : 1, "marker-end": "url(#m-" + (e.kind || "call") + ")" };
+    if (e.dashed) { attrs["stroke-dasharray"] = "5 3"; }
+    el("path", attrs, g);
+    if (e.label) {
+      var lt = el("text", { x: (x1 + x2) / 2, y: (y1 + y2) / 2 - 3, "text-anchor": "middle", "font-size": 10 }, g);
+      lt.textContent = e.label;
+    }
+    el("title", {}, g).textContent = e.tooltip || (e.source + " -> " + e.target);
+  });
+  if (selected && current.items[selected]) { select(selected); } else { select(null); }
+  search();
+}
+
+// select highlights node id with its callers and callees and lists them
+// in the side panel.
+function select(id) {
+  selected = id;
+  var panel = document.getElementById("panel");
+  current.list.forEach(function (it) { it.g.classList.remove("dim", "selected"); });
+  current.edges.forEach(function (e) { e.g.classList.remove("dim"); });
+  if (!id) { panel.style.display = "none"; return; }
+  var keep = {}, callers = [], callees = [];
+  keep[id] = true;
+  current.edges.forEach(function (e) {
+    if (e.target === id) { keep[e.source] = true; callers.push(e.source); }
+    if (e.source === id) { keep[e.target] = true; callees.push(e.target); }
+    if (e.source !== id && e.target !== id) { e.g.classList.add("dim"); }
+  });
+  current.list.forEach(function (it) { if (!keep[it.id]) { it.g.classList.add("dim"); } });
+  current.items[id].g.classList.add("selected");
+  panel.innerHTML = "";
+  var h = document.createElement("h3");
+  h.textContent = id;
+  panel.appendChild(h);
+  var pre = document.createElement("pre");
+  pre.textContent = current.items[id].tooltip || "";
+  panel.appendChild(pre);
+  if (current.items[id].url) {
+    var src = document.createElement("a");
+    src.textContent = "view source";
+    src.href = current.items[id].url;
+    src.target = "_blank";
+    panel.appendChild(src);
+  }
+  [["callers", callers], ["callees", callees]].forEach(function (sec) {
+    var t = document.createElement("h3");
+    t.textContent = sec[0] + " (" + sec[1].length + ")";
+    panel.appendChild(t);
+    sec[1].forEach(function (other) {
+      var a = document.createElement("a");
+      a.textContent = current.items[other].label.split("\n").join(" ");
+      a.title = other;
+      a.addEventListener("click", function () { if (current.items[other].cluster) { delete collapsed[other]; render(); } else { select(other); center(other); } });
+      panel.appendChild(a);
+    });
+  });
+  panel.style.display = "block";
+}
+
+var searchBox = document.getElementById("search");
+function search() {
+  var q = searchBox.value.toLowerCase(), first = null;
+  current.list.forEach(function (it) {
+    var hit = q && (it.label.toLowerCase().indexOf(q) >= 0 || it.id.toLowerCase().indexOf(q) >= 0);
+    it.g.classList.toggle("match", !!hit);
+    if (hit && !first) { first = it.id; }
+  });
+  return first;
+}
+searchBox.addEventListener("input", search);
+searchBox.addEventListener("keydown", function (ev) {
+  if (ev.key !== "Enter") { return; }
+  var q = searchBox.value.toLowerCase();
+  // expand collapsed clusters hiding matching functions
+  Object.keys(nodes).forEach(function (id) {
+    if (q && (nodes[id].label.toLowerCase().indexOf(q) >= 0 || id.toLowerCase().indexOf(q) >= 0)) {
+      for (var p = nodes[id].parent; p; p = clusters[p].parent) { delete collapsed[p]; }
+    }
+  });
+  render();
+  var first = search();
+  if (first) { center(first); }
+});
+
+// pan and zoom
+var svg = document.getElementById("svg"), view0 = { x: 0, y: 0, k: 1 }, drag = null;
+function apply() { scene.setAttribute("transform", "translate(" + view0.x + "," + view0.y + ") scale(" + view0.k + ")"); }
+function center(id) {
+  var b = current.items[id].g.getBBox(), r = svg.getBoundingClientRect();
+  view0.x = r.width / 2 - (b.x + b.width / 2) * view0.k;
+  view0.y = r.height / 2 - (b.y + b.height / 2) * view0.k;
+  apply();
+}
+function fit() {
+  var b = scene.getBBox(), r = svg.getBoundingClientRect();
+  if (!b.width || !b.height) { return; }
+  view0.k = Math.min(r.width / (b.width + 40), r.height / (b.height + 40), 1.5);
+  view0.x = (r.width - b.width * view0.k) / 2 - b.x * view0.k;
+  view0.y = (r.height - b.height * view0.k) / 2 - b.y * view0.k;
+  apply();
+}
+svg.addEventListener("wheel", function (ev) {
+  ev.preventDefault();
+  var f = ev.deltaY < 0 ? 1.1 : 1 / 1.1, r = svg.getBoundingClientRect();
+  var mx = ev.clientX - r.left, my = ev.clientY - r.top;
+  view0.x = mx - (mx - view0.x) * f;
+  view0.y = my - (my - view0.y) * f;
+  view0.k *= f;
+  apply();
+}, { passive: false });
+svg.addEventListener("mousedown", function (ev) { drag = { x: ev.clientX - view0.x, y: ev.clientY - view0.y, moved: false }; });
+window.addEventListener("mousemove", function (ev) {
+  if (!drag) { return; }
+  drag.moved = true;
+  view0.x = ev.clientX - drag.x;
+  view0.y = ev.clientY - drag.y;
+  apply();
+});
+window.addEventListener("mouseup", function () { setTimeout(function () { drag = null; }, 0); });
+svg.addEventListener("click", function () { if (!drag || !drag.moved) { select(null); } });
+
+document.getElementById("collapse").addEventListener("click", function () {
+  Object.keys(clusters).forEach(function (k) { collapsed[k] = true; });
+  render();
+  fit();
+});
+document.getElementById("expand").addEventListener("click", function () { collapsed = {}; render(); fit(); });
+document.getElementById("fit").addEventListener("click", fit);
+
+render();
+fit();
+</script>
+</body>
+</html>
+`
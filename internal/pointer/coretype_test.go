@@ -0,0 +1,70 @@
+package pointer
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+)
+
+func TestCoreType(t *testing.T) {
+	const source = `package p
+
+type MyStr string
+type IntSlice []int
+
+func F[
+	A any,
+	B ~int,
+	C MyStr | string,
+	D IntSlice | []int,
+	E ~int | ~string,
+	F chan int | <-chan int,
+	G interface{ M(); ~[]byte },
+]() {
+}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", source, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conf types.Config
+	pkg, err := conf.Check("p", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tparams := pkg.Scope().Lookup("F").Type().(*types.Signature).TypeParams()
+
+	for _, test := range []struct {
+		expr string
+		want string // "<nil>" if there is no core type
+	}{
+		{"MyStr", "string"},
+		{"A", "<nil>"},
+		{"B", "int"},
+		{"C", "string"}, // terms of the same underlying type
+		{"D", "[]int"},  // terms of the same underlying type
+		{"E", "<nil>"},  // terms of different underlying types
+		{"F", "<-chan int"},
+		{"G", "[]byte"},
+	} {
+		var typ types.Type
+		for i := 0; i < tparams.Len(); i++ {
+			if tp := tparams.At(i); tp.Obj().Name() == test.expr {
+				typ = tp
+			}
+		}
+		if typ == nil {
+			typ = pkg.Scope().Lookup(test.expr).Type()
+		}
+		got := "<nil>"
+		if ct := coreType(typ); ct != nil {
+			got = ct.String()
+		}
+		if got != test.want {
+			t.Errorf("coreType(%s) = %s, want %s", test.expr, got, test.want)
+		}
+	}
+}
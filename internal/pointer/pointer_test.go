@@ -0,0 +1,175 @@
+package pointer_test
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ofabry/go-callvis/internal/pointer"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// input uses what the changes to the x/tools version of the package are
+// for: instances of generic functions and methods, core types of type
+// parameters and type aliases.
+const input = `package main
+
+type I interface{ M() int }
+
+type T struct{}
+
+func (T) M() int { return 1 }
+
+type U struct{}
+
+func (*U) M() int { return 2 }
+
+type Fn = func() int
+
+type IA = I
+
+func one() int { return 1 }
+
+func Call[X I](x X) int { return x.M() }
+
+func Count[S ~string](s S) int {
+	n := 0
+	for range s {
+		n++
+	}
+	return n
+}
+
+type Box[E any] struct{ v E }
+
+func (b *Box[E]) Get() E { return b.v }
+
+func main() {
+	var f Fn = one
+	f()
+	var i IA = T{}
+	i.M()
+	Call(T{})
+	Call(&U{})
+	Count("ab")
+	b := &Box[IA]{v: &U{}}
+	b.Get().M()
+	var e any = i
+	_ = e.(I)
+}
+`
+
+func TestAnalyzeGenericsAndAliases(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "input.go", input, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	main, _, err := ssautil.BuildPackage(&types.Config{Importer: importer.Default()}, fset,
+		types.NewPackage("main", "main"), []*ast.File{f}, ssa.InstantiateGenerics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := pointer.Analyze(&pointer.Config{
+		Mains:          []*ssa.Package{main},
+		BuildCallGraph: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := make(map[string]bool)
+	callgraph.GraphVisitEdges(result.CallGraph, func(e *callgraph.Edge) error {
+		if e.Caller.Func.Pkg == main || e.Caller.Func.Origin() != nil {
+			calls[e.Caller.Func.String()+" -> "+e.Callee.Func.String()] = true
+		}
+		return nil
+	})
+	for _, want := range []string{
+		"main.main -> main.one",
+		"main.main -> (main.T).M",
+		"main.main -> main.Call[main.T]",
+		"main.main -> main.Call[*main.U]",
+		"main.Call[main.T] -> (main.T).M",
+		"main.Call[*main.U] -> (*main.U).M",
+		"main.main -> main.Count[string]",
+		"main.main -> (*main.Box[main.IA]).Get",
+		"main.main -> (*main.U).M",
+	} {
+		if !calls[want] {
+			t.Errorf("missing call %s", want)
+		}
+	}
+	for _, unwanted := range []string{
+		"main.Call[main.T] -> (*main.U).M",
+		"main.Call[*main.U] -> (main.T).M",
+	} {
+		if calls[unwanted] {
+			t.Errorf("unexpected call %s", unwanted)
+		}
+	}
+	if t.Failed() {
+		var l []string
+		for c := range calls {
+			l = append(l, c)
+		}
+		sort.Strings(l)
+		t.Logf("calls:\n%s", strings.Join(l, "\n"))
+	}
+}
+
+// TestAnalyzeReflectInterface analyzes a program whose reflection makes an
+// interface a runtime type, so that its abstract methods are in a method
+// set the analysis generates constraints for.
+func TestAnalyzeReflectInterface(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"go.mod": "module rt\n",
+		"main.go": `package main
+
+import "reflect"
+
+type I interface{ M() int }
+
+func main() {
+	var i I
+	println(reflect.TypeOf(&i).Elem().String())
+}
+`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	initial, err := packages.Load(&packages.Config{Mode: packages.LoadAllSyntax, Dir: dir}, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packages.PrintErrors(initial) > 0 {
+		t.Fatal("packages contain errors")
+	}
+	prog, pkgs := ssautil.AllPackages(initial, ssa.InstantiateGenerics)
+	prog.Build()
+
+	result, err := pointer.Analyze(&pointer.Config{
+		Mains:          pkgs,
+		BuildCallGraph: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := result.CallGraph.Nodes[pkgs[0].Func("main")]; n == nil || len(n.Out) == 0 {
+		t.Errorf("no calls of main.main in the call graph")
+	}
+}
@@ -3,15 +3,17 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
-	"go/build"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/pkg/browser"
@@ -31,49 +33,79 @@ Flags:
 `
 
 var (
-	focusFlag    = flag.String("focus", "main", "Focus specific package using name or import path.")
-	groupFlag    = flag.String("group", "pkg", "Grouping functions by packages and/or types [pkg, type] (separated by comma)")
-	limitFlag    = flag.String("limit", "", "Limit package paths to given prefixes (separated by comma)")
-	ignoreFlag   = flag.String("ignore", "", "Ignore package paths containing given prefixes (separated by comma)")
-	includeFlag  = flag.String("include", "", "Include package paths with given prefixes (separated by comma)")
-	nostdFlag    = flag.Bool("nostd", false, "Omit calls to/from packages in standard library.")
-	nointerFlag  = flag.Bool("nointer", false, "Omit calls to unexported functions.")
-	testFlag     = flag.Bool("tests", false, "Include test code.")
-	graphvizFlag = flag.Bool("graphviz", false, "Use Graphviz's dot program to render images.")
-	httpFlag     = flag.String("http", ":7878", "HTTP service address.")
-	skipBrowser  = flag.Bool("skipbrowser", false, "Skip opening browser.")
-	outputFile   = flag.String("file", "", "output filename - omit to use server mode")
-	outputFormat = flag.String("format", "svg", "output file format [svg | png | jpg | ...]")
-	cacheDir     = flag.String("cacheDir", "", "Enable caching to avoid unnecessary re-rendering, you can force rendering by adding 'refresh=true' to the URL query or emptying the cache directory")
-	debugFlag    = flag.Bool("debug", false, "Enable verbose log.")
-	versionFlag  = flag.Bool("version", false, "Show version and exit.")
-	c_root_path  = flag.String("c_root_path", "", "cgo package's root path")
-	c_dot_path   = flag.String("c_dot_path", "", "cgo's dot format callgraph")
+	focusFlag     = flag.String("focus", "main", "Focus specific package using name or import path.")
+	groupFlag     = flag.String("group", "pkg", "Grouping functions by modules, directories, packages, files and/or types [module, dir, pkg, file, type] (separated by comma)")
+	collapseFlag  = flag.String("collapse", "", "Collapse functions of each package or type into a single node [pkg, type]")
+	callsitesFlag = flag.String("callsites", "merge", "Draw the calls between two functions as one edge, one edge labelled with the number of call sites or one edge per call site [merge, count, each]")
+	genericsFlag  = flag.String("generics", "inst", "Draw generic functions as one node per instantiation labelled with its type arguments or one node per generic declaration [inst, decl]")
+	limitFlag     = flag.String("limit", "", "Limit package paths to given prefixes (separated by comma)")
+	ignoreFlag    = flag.String("ignore", "", "Ignore package paths containing given prefixes (separated by comma)")
+	includeFlag   = flag.String("include", "", "Include package paths with given prefixes (separated by comma)")
+	nostdFlag     = flag.Bool("nostd", false, "Omit calls to/from packages in standard library.")
+	nointerFlag   = flag.Bool("nointer", false, "Omit calls to unexported functions.")
+	dispatchFlag  = flag.Bool("dispatch", false, "Draw interface method calls through a node of the interface method.")
+	embeddingFlag = flag.Bool("embedding", false, "Label calls of methods promoted from embedded fields with their embedding path and show which types embed others.")
+	funcsFlag     = flag.Bool("funcs", false, "Mark where function values and closures called elsewhere are created, by an edge from the creating function.")
+	coverFlag     = flag.String("coverprofile", "", "Color functions by their statement coverage in the given Go coverage profile.")
+	hidecovFlag   = flag.Bool("hidecovered", false, "Omit fully covered functions, requires -coverprofile.")
+	pprofFlag     = flag.String("pprof", "", "Weight functions and calls by their cost in the given CPU or heap profile (pprof format).")
+	hidecoldFlag  = flag.Bool("hideunsampled", false, "Omit functions without samples in the profile, requires -pprof.")
+	traceFlag     = flag.String("calltrace", "", "Mark the dynamic calls observed at runtime, read from a pprof profile (e.g. by go tool trace -pprof) or a log of caller and callee per line.")
+	concFlag      = flag.Bool("concurrency", false, "Show goroutine spawn sites, channels connecting senders and receivers, and WaitGroup/Mutex calls.")
+	testFlag      = flag.Bool("tests", false, "Analyze the tests, benchmarks, fuzz tests and examples of the packages, showing what they reach.")
+	goosFlag      = flag.String("goos", "", "Target operating system of the analysis, defaults to GOOS. A comma separated list compares operating systems like -buildconfig.")
+	goarchFlag    = flag.String("goarch", "", "Target architecture of the analysis, defaults to GOARCH. A comma separated list compares architectures like -buildconfig.")
+	testRunFlag   = flag.String("test-run", "", "Show only what the tests, benchmarks, fuzz tests and examples matching the given regular expression reach, requires -tests.")
+	graphvizFlag  = flag.Bool("graphviz", false, "Use Graphviz's dot program to render images.")
+	httpFlag      = flag.String("http", ":7878", "HTTP service address.")
+	skipBrowser   = flag.Bool("skipbrowser", false, "Skip opening browser.")
+	outputFile    = flag.String("file", "", "output filename without extension, - for stdout - omit to use server mode")
+	outputPath    = flag.String("o", "", "exact output path including extension, - for stdout - overrides -file")
+	emitDot       = flag.Bool("emit-dot", true, "Write the intermediate <file>.gv next to image output.")
+	outputFormat  = flag.String("format", "svg", "output file format [svg | png | jpg | mermaid | plantuml | d2 | graphml | gexf | cytoscape | html | ...]")
+	srcurlFlag    = flag.String("sourceurl", "", "URL template linking nodes and edges to their source, with {file}, {relfile} and {line} replaced (e.g. vscode://file{file}:{line}), defaults to the source viewer in server mode.")
+	cacheDir      = flag.String("cacheDir", "", "Enable caching to avoid unnecessary re-rendering, you can force rendering by adding 'refresh=true' to the URL query or emptying the cache directory")
+	debugFlag     = flag.Bool("debug", false, "Enable verbose log.")
+	versionFlag   = flag.Bool("version", false, "Show version and exit.")
+	c_root_path   = flag.String("c_root_path", "", "cgo package's root path")
+	c_dot_path    = flag.String("c_dot_path", "", "cgo's dot format callgraph")
+	c_ll_path     = flag.String("c_ll_path", "", "cgo's linked LLVM IR, used to locate and cluster C functions")
+	noclibFlag    = flag.Bool("noclib", false, "Omit calls to C library functions and functions defined in system headers.")
+	cignoreFlag   = flag.String("cignore", "", "Ignore C functions matching given name patterns, e.g. __*,printf (separated by comma)")
+	cgoStrictFlag = flag.Bool("cgo-strict", false, "Fail if any step of the cgo pipeline fails instead of rendering a partial C graph.")
 )
 
 func init() {
-	flag.Var((*buildutil.TagsFlag)(&build.Default.BuildTags), "tags", buildutil.TagsFlagDoc)
+	flag.Var((*buildutil.TagsFlag)(&tagsFlag), "tags", buildutil.TagsFlagDoc)
 	// Graphviz options
 	flag.UintVar(&minlen, "minlen", 2, "Minimum edge length (for wider output).")
 	flag.Float64Var(&nodesep, "nodesep", 0.35, "Minimum space between two adjacent nodes in the same rank (for taller output).")
 	flag.StringVar(&nodeshape, "nodeshape", "box", "graph node shape (see graphvis manpage for valid values)")
 	flag.StringVar(&nodestyle, "nodestyle", "filled,rounded", "graph node style (see graphvis manpage for valid values)")
 	flag.StringVar(&rankdir, "rankdir", "LR", "Direction of graph layout [LR | RL | TB | BT]")
-	flag.Var(&DSymbols, "unifdef", "unifdef preprocess symbol")
+	flag.Var(&CMacros, "cmacro", "C macro passed to clang, e.g. -DA=1 or -UB (repeatable)")
+	flag.Var(&CMacros, "unifdef", "Deprecated: use -cmacro")
+	flag.Var(&CConfigs, "cconfig", "C macro configuration analysed and merged into one graph, e.g. linux=-DLINUX,-UWIN (repeatable)")
+	flag.Var(&BuildConfigs, "buildconfig", "Build configuration analysed and merged into one graph, marking the calls of some configurations only, e.g. linux/amd64 or windows/arm64,purego (repeatable)")
 }
 
-type unifdefSymbols []string
+type stringList []string
 
-func (i *unifdefSymbols) String() string {
-	return "unifdefSymbols"
+func (i *stringList) String() string {
+	return strings.Join(*i, " ")
 }
 
-func (i *unifdefSymbols) Set(value string) error {
+func (i *stringList) Set(value string) error {
 	*i = append(*i, value)
 	return nil
 }
 
-var DSymbols unifdefSymbols
+var (
+	CMacros      stringList
+	CConfigs     stringList
+	BuildConfigs stringList
+	tagsFlag     []string
+)
 
 func logf(f string, a ...interface{}) {
 	if *debugFlag {
@@ -103,6 +135,9 @@ func openBrowser(url string) {
 	}
 }
 
+// outputDot writes the graph in outputFormat to <fname>.<format>, to the
+// exact path given by -o, or to stdout if either is "-". Image formats also
+// write the intermediate <fname>.gv unless -emit-dot=false.
 func outputDot(fname string, outputFormat string) {
 	// get cmdline default for analysis
 	Analysis.OptsSetup()
@@ -111,24 +146,112 @@ func outputDot(fname string, outputFormat string) {
 		log.Fatalf("%v\n", e)
 	}
 
-	output, err := Analysis.Render()
+	dotg, err := Analysis.Render()
 	if err != nil {
 		log.Fatalf("%v\n", err)
 	}
 
-	log.Println("writing dot output..")
+	w, isText := graphWriters[outputFormat]
+	out := *outputPath
+	if out == "" {
+		out = fname
+		if fname != "-" && isText {
+			out = fmt.Sprintf("%s.%s", fname, w.ext)
+		} else if fname != "-" {
+			out = fmt.Sprintf("%s.%s", fname, outputFormat)
+		}
+	}
+
+	var buf bytes.Buffer
+	if isText {
+		log.Printf("writing %s output..\n", outputFormat)
+		if err := w.write(dotg, &buf); err != nil {
+			log.Fatalf("%v\n", err)
+		}
+		if err := writeOutput(out, buf.Bytes()); err != nil {
+			log.Fatalf("%v\n", err)
+		}
+		logCgoFailures()
+		return
+	}
+
+	if err := dotg.WriteDot(&buf); err != nil {
+		log.Fatalf("%v\n", err)
+	}
+	output := buf.Bytes()
+
+	if gv := strings.TrimSuffix(out, filepath.Ext(out)) + ".gv"; *emitDot && out != "-" && gv != out {
+		log.Println("writing dot output..")
 
-	writeErr := ioutil.WriteFile(fmt.Sprintf("%s.gv", fname), output, 0755)
-	if writeErr != nil {
-		log.Fatalf("%v\n", writeErr)
+		if err := ioutil.WriteFile(gv, output, 0644); err != nil {
+			log.Fatalf("%v\n", err)
+		}
 	}
 
 	log.Printf("converting dot to %s..\n", outputFormat)
 
-	_, err = dotToImage(fname, outputFormat, output)
+	if out != "-" {
+		if err := dotToImageFile(out, outputFormat, output); err != nil {
+			log.Fatalf("%v\n", err)
+		}
+		logCgoFailures()
+		return
+	}
+
+	img, err := dotToImage("", outputFormat, output)
 	if err != nil {
 		log.Fatalf("%v\n", err)
 	}
+	defer os.Remove(img)
+	b, err := ioutil.ReadFile(img)
+	if err != nil {
+		log.Fatalf("%v\n", err)
+	}
+	if err := writeOutput(out, b); err != nil {
+		log.Fatalf("%v\n", err)
+	}
+	logCgoFailures()
+}
+
+// outputFormatFor returns -format, or the format given by the extension of
+// the -o path if -format is not set
+func outputFormatFor(path string) string {
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	if isFlagSet("format") || ext == "" || path == "-" {
+		return *outputFormat
+	}
+	for format, w := range graphWriters {
+		if w.ext == ext {
+			return format
+		}
+	}
+	return ext
+}
+
+// isFlagSet reports whether the flag name is given on the command line
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// writeOutput writes data to path, or to stdout if path is "-"
+func writeOutput(path string, data []byte) error {
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func logCgoFailures() {
+	if summary := cgoFailures.Summary(); summary != "" {
+		log.Print(summary)
+	}
 }
 
 //noinspection GoUnhandledErrorResult
@@ -151,17 +274,55 @@ func main() {
 
 	args := flag.Args()
 	tests := *testFlag
+	if tests && !isFlagSet("focus") {
+		// the tests select what is shown, the default focus is the
+		// generated test main package
+		*focusFlag = ""
+	}
 	httpAddr := *httpFlag
 	urlAddr := parseHTTPAddr(httpAddr)
 
+	configs, err := getBuildConfigs()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// the views of the web UI can be turned on by any request
+	server := *outputFile == "" && *outputPath == ""
+	views := analysisViews{
+		funcs: *funcsFlag || server,
+		conc:  *concFlag || server,
+	}
+
 	Analysis = new(analysis)
-	if err := Analysis.DoAnalysis("", tests, args); err != nil {
+	if err := Analysis.DoAnalysis(configs[0], "", tests, views, args); err != nil {
 		log.Fatal(err)
 	}
+	if len(configs) > 1 {
+		if err := Analysis.LoadMatrix(configs, "", tests, args); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *coverFlag != "" {
+		if err := Analysis.LoadCoverage(*coverFlag); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *pprofFlag != "" {
+		if err := Analysis.LoadProfile(*pprofFlag); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *traceFlag != "" {
+		if err := Analysis.LoadCallTrace(*traceFlag); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	http.HandleFunc("/", handler)
+	http.HandleFunc("/source", sourceHandler)
 
-	if *outputFile == "" {
+	if server {
 		*outputFile = "output"
 		if !*skipBrowser {
 			go openBrowser(urlAddr)
@@ -173,6 +334,6 @@ func main() {
 			log.Fatal(err)
 		}
 	} else {
-		outputDot(*outputFile, *outputFormat)
+		outputDot(*outputFile, outputFormatFor(*outputPath))
 	}
 }
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var mermaidEscaper = strings.NewReplacer(
+	"#", "#35;",
+	`"`, "#quot;",
+	"<", "#lt;",
+	">", "#gt;",
+	"\n", "<br/>",
+)
+
+// mermaidText quotes s for use as a Mermaid node, subgraph or edge label.
+func mermaidText(s string) string {
+	return `"` + mermaidEscaper.Replace(s) + `"`
+}
+
+// mermaidStyle converts Graphviz fill, border and line attributes to
+// Mermaid style properties.
+func mermaidStyle(attrs dotAttrs, fill string) string {
+	var props []string
+	if fill != "" {
+		props = append(props, "fill:"+cssColor(fill))
+	}
+	if c := attrs["color"]; c != "" {
+		props = append(props, "stroke:"+cssColor(c))
+	}
+	if w := attrs["penwidth"]; w != "" {
+		props = append(props, "stroke-width:"+w+"px")
+	}
+	if s := attrs["style"]; strings.Contains(s, "dotted") || strings.Contains(s, "dashed") {
+		props = append(props, "stroke-dasharray:3 3")
+	}
+	return strings.Join(props, ",")
+}
+
+type mermaidWriter struct {
+	w     *bufio.Writer
+	ids   map[*dotNode]string
+	nodes int
+	subs  int
+}
+
+func (m *mermaidWriter) node(n *dotNode, indent string) {
+	id := fmt.Sprintf("n%d", m.nodes)
+	m.nodes++
+	m.ids[n] = id
+
+	label := n.Attrs["label"]
+	if label == "" {
+		label = n.ID
+	}
+	open, close := "(", ")"
+	if n.Attrs["shape"] == "ellipse" {
+		open, close = "([", "])"
+	} else if !strings.Contains(nodestyle, "rounded") && !strings.Contains(n.Attrs["style"], "rounded") {
+		open, close = "[", "]"
+	}
+	fmt.Fprintf(m.w, "%s%s%s%s%s\n", indent, id, open, mermaidText(label), close)
+	if style := mermaidStyle(n.Attrs, n.Attrs["fillcolor"]); style != "" {
+		fmt.Fprintf(m.w, "%sstyle %s %s\n", indent, id, style)
+	}
+}
+
+func (m *mermaidWriter) cluster(c *dotCluster, indent string) {
+	id := fmt.Sprintf("s%d", m.subs)
+	m.subs++
+
+	fmt.Fprintf(m.w, "%ssubgraph %s[%s]\n", indent, id, mermaidText(c.Attrs["label"]))
+	m.clusterBody(c, indent+"    ")
+	fmt.Fprintf(m.w, "%send\n", indent)
+
+	fill := c.Attrs["fillcolor"]
+	if fill == "" {
+		fill = c.Attrs["bgcolor"]
+	}
+	if style := mermaidStyle(dotAttrs{"penwidth": c.Attrs["penwidth"]}, fill); style != "" {
+		fmt.Fprintf(m.w, "%sstyle %s %s\n", indent, id, style)
+	}
+}
+
+func (m *mermaidWriter) clusterBody(c *dotCluster, indent string) {
+	for _, n := range sortedNodes(c.Nodes) {
+		m.node(n, indent)
+	}
+	for _, sub := range c.sortedClusters() {
+		m.cluster(sub, indent)
+	}
+}
+
+// WriteMermaid writes the graph as a Mermaid flowchart. Package and type
+// clusters become subgraphs, dynamic calls are dashed and go/defer calls
+// are labelled.
+func (g *dotGraph) WriteMermaid(w io.Writer) error {
+	m := &mermaidWriter{
+		w:   bufio.NewWriter(w),
+		ids: make(map[*dotNode]string),
+	}
+
+	title := g.Title
+	if g.Warning != "" {
+		title = fmt.Sprintf("%s (%s)", title, g.Warning)
+	}
+	fmt.Fprintf(m.w, "---\ntitle: %s\n---\n", mermaidText(title))
+
+	dir := g.Options["rankdir"]
+	switch dir {
+	case "LR", "RL", "TB", "BT":
+	default:
+		dir = "LR"
+	}
+	fmt.Fprintf(m.w, "flowchart %s\n", dir)
+
+	if g.Cluster != nil {
+		// the root cluster is only drawn when it is labelled by focus
+		if g.Cluster.Attrs["label"] != "" {
+			m.cluster(g.Cluster, "    ")
+		} else {
+			m.clusterBody(g.Cluster, "    ")
+		}
+	}
+	if g.CCluster != nil {
+		m.cluster(g.CCluster, "    ")
+	}
+	for _, n := range sortedNodes(g.Nodes) {
+		m.node(n, "    ")
+	}
+
+	for i, e := range g.sortedEdges() {
+		for _, n := range []*dotNode{e.From, e.To} {
+			if _, ok := m.ids[n]; !ok {
+				m.node(n, "    ")
+			}
+		}
+
+		arrow := "-->"
+		if e.dashed() {
+			arrow = "-.->"
+		} else if strings.Contains(e.Attrs["style"], "bold") {
+			arrow = "==>"
+		}
+		if labels := e.labels(); len(labels) > 0 {
+			arrow += "|" + mermaidText(strings.Join(labels, " ")) + "|"
+		}
+
+		fmt.Fprintf(m.w, "    %s %s %s\n", m.ids[e.From], arrow, m.ids[e.To])
+		if c := e.Attrs["color"]; c != "" {
+			fmt.Fprintf(m.w, "    linkStyle %d stroke:%s\n", i, cssColor(c))
+		}
+	}
+
+	return m.w.Flush()
+}
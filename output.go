@@ -1,11 +1,14 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
 	"go/build"
+	"go/token"
 	"go/types"
+	"log"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"golang.org/x/tools/go/callgraph"
@@ -13,11 +16,11 @@ import (
 )
 
 func isSynthetic(edge *callgraph.Edge) bool {
-	return edge.Caller.Func.Pkg == nil || edge.Callee.Func.Synthetic != ""
+	return funcPkg(edge.Caller.Func) == nil || isSyntheticFunc(edge.Callee.Func)
 }
 
 func inStd(node *callgraph.Node) bool {
-	pkg, _ := build.Import(node.Func.Pkg.Pkg.Path(), "", 0)
+	pkg, _ := build.Import(funcPkg(node.Func).Path(), "", 0)
 	return pkg.Goroot
 }
 
@@ -48,9 +51,33 @@ func defaultEdge(caller *dotNode, callee *dotNode) *dotEdge {
 		From:  caller,
 		To:    callee,
 		Attrs: defaultAttr(""),
+		Info:  &edgeInfo{Kind: "call"},
 	}
 }
 
+// outputOpts are the options of printOutput beyond the filters of the Go
+// call graph: the C graph, the alternative views and the overlays. Render
+// builds them from the render options and what the analysis loaded, zero
+// values leave the graph as is.
+type outputOpts struct {
+	modules         map[string]*pkgModule  // modules by package path, see -group
+	cignorePatterns []string               // see -cignore
+	noclib          bool                   // see -noclib
+	dispatch        bool                   // see -dispatch
+	promoted        *promotions            // see -embedding
+	flows           []funcFlow             // see -funcs
+	conc            *concurrency           // see -concurrency
+	cov             *coverage              // see -coverprofile
+	hideCovered     bool                   // see -hidecovered, requires cov
+	prof            *pprofData             // see -pprof
+	hideUnsampled   bool                   // see -hideunsampled, requires prof
+	trace           *callTrace             // see -calltrace
+	callSites       string                 // see -callsites
+	generics        string                 // see -generics
+	tested          map[string]bool        // functions reached by the tests, see -tests
+	matrix          *buildMatrix           // see -buildconfig
+}
+
 func printOutput(
 	prog *ssa.Program,
 	mainPkg *types.Package,
@@ -62,18 +89,26 @@ func printOutput(
 	groupBy []string,
 	nostd,
 	nointer bool,
-) ([]byte, error) {
-	var groupType, groupPkg bool
+	opts *outputOpts,
+) (*dotGraph, error) {
+	var groupType, groupPkg, groupModule, groupDir, groupFile bool
 	for _, g := range groupBy {
 		switch g {
 		case "pkg":
 			groupPkg = true
 		case "type":
 			groupType = true
+		case "module":
+			groupModule = true
+		case "dir":
+			groupDir = true
+		case "file":
+			groupFile = true
 		}
 	}
 
 	cluster := NewDotCluster("focus")
+	cluster.Kind = "focus"
 	cluster.Attrs = dotAttrs{
 		"bgcolor":   "white",
 		"label":     "",
@@ -104,21 +139,21 @@ func printOutput(
 	var isFocused = func(edge *callgraph.Edge) bool {
 		caller := edge.Caller
 		callee := edge.Callee
-		if focusPkg != nil && (caller.Func.Pkg.Pkg.Path() == focusPkg.Path() || callee.Func.Pkg.Pkg.Path() == focusPkg.Path()) {
+		if focusPkg != nil && (funcPkg(caller.Func).Path() == focusPkg.Path() || funcPkg(callee.Func).Path() == focusPkg.Path()) {
 			return true
 		}
 		fromFocused := false
 		toFocused := false
 		for _, e := range caller.In {
 			if !isSynthetic(e) && focusPkg != nil &&
-				e.Caller.Func.Pkg.Pkg.Path() == focusPkg.Path() {
+				funcPkg(e.Caller.Func).Path() == focusPkg.Path() {
 				fromFocused = true
 				break
 			}
 		}
 		for _, e := range callee.Out {
 			if !isSynthetic(e) && focusPkg != nil &&
-				e.Callee.Func.Pkg.Pkg.Path() == focusPkg.Path() {
+				funcPkg(e.Callee.Func).Path() == focusPkg.Path() {
 				toFocused = true
 				break
 			}
@@ -131,7 +166,7 @@ func printOutput(
 	}
 
 	var inIncludes = func(node *callgraph.Node) bool {
-		pkgPath := node.Func.Pkg.Pkg.Path()
+		pkgPath := funcPkg(node.Func).Path()
 		for _, p := range includePaths {
 			if strings.HasPrefix(pkgPath, p) {
 				return true
@@ -141,7 +176,7 @@ func printOutput(
 	}
 
 	var inLimits = func(node *callgraph.Node) bool {
-		pkgPath := node.Func.Pkg.Pkg.Path()
+		pkgPath := funcPkg(node.Func).Path()
 		for _, p := range limitPaths {
 			if strings.HasPrefix(pkgPath, p) {
 				return true
@@ -151,7 +186,7 @@ func printOutput(
 	}
 
 	var inIgnores = func(node *callgraph.Node) bool {
-		pkgPath := node.Func.Pkg.Pkg.Path()
+		pkgPath := funcPkg(node.Func).Path()
 		for _, p := range ignorePaths {
 			if strings.HasPrefix(pkgPath, p) {
 				return true
@@ -160,6 +195,23 @@ func printOutput(
 		return false
 	}
 
+	// node-level variant of the filters below, used for cgo edges
+	var inFilters = func(node *callgraph.Node) bool {
+		if nostd && inStd(node) {
+			return false
+		}
+		if len(includePaths) > 0 && inIncludes(node) {
+			return true
+		}
+		if len(limitPaths) > 0 && !inLimits(node) {
+			return false
+		}
+		if len(ignorePaths) > 0 && inIgnores(node) {
+			return false
+		}
+		return true
+	}
+
 	var isInter = func(edge *callgraph.Edge) bool {
 		//caller := edge.Caller
 		callee := edge.Callee
@@ -169,42 +221,181 @@ func printOutput(
 		return false
 	}
 
-	count := 0
-	err := callgraph.GraphVisitEdges(cg, func(edge *callgraph.Edge) error {
-		count++
+	// interface methods called through dynamic dispatch, see -dispatch
+	dispatchNodes := make(map[string]*dotNode)
+	dispatchSites := make(map[ssa.CallInstruction]bool)
+	dispatchImpls := make(map[*dotEdge][2]int)
 
+	var dispatchNode = func(common *ssa.CallCommon) *dotNode {
+		iface := common.Value.Type()
+		id := fmt.Sprintf("(%s).%s", iface, common.Method.Name())
+		if n, ok := dispatchNodes[id]; ok {
+			return n
+		}
+		qualifier := func(p *types.Package) string {
+			if focusPkg != nil && p.Path() == focusPkg.Path() {
+				return ""
+			}
+			return p.Name()
+		}
+		pos := prog.Fset.Position(common.Method.Pos())
+		isFocused := focusPkg != nil && common.Method.Pkg() != nil &&
+			common.Method.Pkg().Path() == focusPkg.Path()
+		n := &dotNode{
+			ID: id,
+			Attrs: dotAttrs{
+				"label":     fmt.Sprintf("%s.%s", types.TypeString(iface, qualifier), common.Method.Name()),
+				"shape":     "hexagon",
+				"style":     "dashed,filled",
+				"fillcolor": "#f1e6fa",
+				"tooltip":   fmt.Sprintf("interface method: %s | declared in %s:%d", id, filepath.Base(pos.Filename), pos.Line),
+			},
+			Info: &nodeInfo{
+				Type:     iface.String(),
+				File:     pos.Filename,
+				Line:     pos.Line,
+				Exported: common.Method.Exported(),
+				Focused:  isFocused,
+				Lang:     "go",
+				Kind:     "dispatch",
+			},
+		}
+		if common.Method.Pkg() != nil {
+			n.Info.Package = common.Method.Pkg().Path()
+		}
+		if isFocused {
+			cluster.Nodes = append(cluster.Nodes, n)
+		} else {
+			nodes = append(nodes, n)
+		}
+		dispatchNodes[id] = n
+		return n
+	}
+
+	// goroutine spawn sites, see -concurrency
+	spawnNodes := make(map[*ssa.Go]*dotNode)
+
+	var spawnNode = func(site *ssa.Go) *dotNode {
+		if n, ok := spawnNodes[site]; ok {
+			return n
+		}
+		pos := prog.Fset.Position(site.Pos())
+		parent := site.Parent()
+		parentPkg := funcPkg(parent)
+		isFocused := focusPkg != nil && parentPkg != nil && parentPkg.Path() == focusPkg.Path()
+		n := &dotNode{
+			ID: fmt.Sprintf("go@%s:%d:%d", pos.Filename, pos.Line, pos.Column),
+			Attrs: dotAttrs{
+				"label":     fmt.Sprintf("go\n%s:%d", filepath.Base(pos.Filename), pos.Line),
+				"shape":     "invhouse",
+				"style":     "filled",
+				"fillcolor": "#ffd9b3",
+				"tooltip":   fmt.Sprintf("goroutine spawned in %s at %s:%d", parent, filepath.Base(pos.Filename), pos.Line),
+			},
+			Info: &nodeInfo{
+				File:    pos.Filename,
+				Line:    pos.Line,
+				Focused: isFocused,
+				Lang:    "go",
+				Kind:    "spawn",
+			},
+		}
+		if parentPkg != nil {
+			n.Info.Package = parentPkg.Path()
+		}
+		if isFocused {
+			cluster.Nodes = append(cluster.Nodes, n)
+		} else {
+			nodes = append(nodes, n)
+		}
+		spawnNodes[site] = n
+		return n
+	}
+
+	// number of implementations resolved for the call site of edge
+	var siteImpls = func(edge *callgraph.Edge) int {
+		impls := make(map[*callgraph.Node]bool)
+		for _, e := range edge.Caller.Out {
+			if e.Site == edge.Site {
+				impls[e.Callee] = true
+			}
+		}
+		return len(impls)
+	}
+
+	// calls of promoted methods, the types along their paths and type
+	// clusters, see -embedding
+	viaPaths := make(map[*dotEdge][]string)
+	pathTypes := make(map[*types.TypeName]bool)
+	typeClusters := make(map[*types.TypeName][]*dotCluster)
+
+	var addVia = func(e *dotEdge, path promotionPath) {
+		for _, t := range path.types {
+			pathTypes[t] = true
+		}
+		for _, p := range viaPaths[e] {
+			if p == path.names {
+				return
+			}
+		}
+		viaPaths[e] = append(viaPaths[e], path.names)
+	}
+
+	// calls of the static call graph, to tell the calls only seen in a profile
+	staticCalls := make(map[[2]string]bool)
+
+	// source text of the calls
+	var exprs callExprs
+
+	// call sites of the edges, as the call graph has an edge per context
+	// of a call
+	edgeSites := make(map[*dotEdge]map[token.Pos]bool)
+
+	// labels of the generic functions of instantiations, see -generics
+	genericLabels := make(map[string]string)
+
+	// omitCall tells whether edge is left out of the graph by the options
+	var omitCall = func(edge *callgraph.Edge) bool {
 		caller := edge.Caller
 		callee := edge.Callee
 
-		posCaller := prog.Fset.Position(caller.Func.Pos())
-		posCallee := prog.Fset.Position(callee.Func.Pos())
-		posEdge := prog.Fset.Position(edge.Pos())
-		//fileCaller := fmt.Sprintf("%s:%d", posCaller.Filename, posCaller.Line)
-		filenameCaller := filepath.Base(posCaller.Filename)
-
 		// omit synthetic calls
 		if isSynthetic(edge) {
-			return nil
+			return true
 		}
 
-		callerPkg := caller.Func.Pkg.Pkg
-		calleePkg := callee.Func.Pkg.Pkg
+		// omit calls the selected tests cannot reach
+		if opts.tested != nil && !opts.tested[caller.Func.String()] {
+			return true
+		}
 
 		// focus specific pkg
 		if focusPkg != nil &&
 			!isFocused(edge) {
-			return nil
+			return true
 		}
 
 		// omit std
 		if nostd &&
 			(inStd(caller) || inStd(callee)) {
-			return nil
+			return true
 		}
 
 		// omit inter
 		if nointer && isInter(edge) {
-			return nil
+			return true
+		}
+
+		// omit fully covered
+		if opts.hideCovered &&
+			(opts.cov.fullyCovered(caller.Func.Prog.Fset, caller.Func) || opts.cov.fullyCovered(callee.Func.Prog.Fset, callee.Func)) {
+			return true
+		}
+
+		// omit functions without samples
+		if opts.hideUnsampled &&
+			(opts.prof.cum[caller.Func.String()] == 0 || opts.prof.cum[callee.Func.String()] == 0) {
+			return true
 		}
 
 		include := false
@@ -220,180 +411,316 @@ func printOutput(
 			if len(limitPaths) > 0 &&
 				(!inLimits(caller) || !inLimits(callee)) {
 				logf("NOT in limit: %s -> %s", caller, callee)
-				return nil
+				return true
 			}
 
 			// ignore path prefixes
 			if len(ignorePaths) > 0 &&
 				(inIgnores(caller) || inIgnores(callee)) {
 				logf("IS ignored: %s -> %s", caller, callee)
-				return nil
+				return true
 			}
 		}
+		return false
+	}
 
-		//var buf bytes.Buffer
-		//data, _ := json.MarshalIndent(caller.Func, "", " ")
-		//logf("call node: %s -> %s\n %v", caller, callee, string(data))
-		logf("call node: %s -> %s (%s -> %s) %v\n", caller.Func.Pkg, callee.Func.Pkg, caller, callee, filenameCaller)
-
-		var sprintNode = func(node *callgraph.Node, isCaller bool) *dotNode {
-			// only once
-			key := node.Func.String()
-			nodeTooltip := ""
+	// pkgCluster returns the cluster of the functions of pkg declared in
+	// filename, creating the module, directory, pkg and file clusters
+	// they are grouped by
+	var pkgCluster = func(pkg *types.Package, goroot, isFocused bool, filename string) *dotCluster {
+		c := cluster
 
-			fileCaller := fmt.Sprintf("%s:%d", filepath.Base(posCaller.Filename), posCaller.Line)
-			fileCallee := fmt.Sprintf("%s:%d", filepath.Base(posCallee.Filename), posCallee.Line)
+		if !isFocused {
+			pkgPath := pkg.Path()
+			base, rel := "", pkgPath
 
-			if isCaller {
-				nodeTooltip = fmt.Sprintf("%s | defined in %s", node.Func.String(), fileCaller)
-			} else {
-				nodeTooltip = fmt.Sprintf("%s | defined in %s", node.Func.String(), fileCallee)
+			// group by module
+			if m := opts.modules[pkgPath]; groupModule && m != nil {
+				c = moduleCluster(c, m, goroot)
+				if pkgPath == m.Path {
+					base, rel = m.Path, ""
+				} else if strings.HasPrefix(pkgPath, m.Path+"/") {
+					base, rel = m.Path, strings.TrimPrefix(pkgPath, m.Path+"/")
+				}
 			}
 
-			if n, ok := nodeMap[key]; ok {
-				return n
+			// group by directory, the package itself being the
+			// innermost directory unless grouped by pkg
+			if groupDir {
+				if groupPkg {
+					rel = path.Dir(rel)
+					if rel == "." {
+						rel = ""
+					}
+				}
+				c = dirClusters(c, base, rel, goroot)
 			}
+		}
 
-			// is focused
-			isFocused := focusPkg != nil &&
-				node.Func.Pkg.Pkg.Path() == focusPkg.Path()
-			attrs := make(dotAttrs)
-
-			// node label
-			label := node.Func.RelString(node.Func.Pkg.Pkg)
-
-			// func signature
-			sign := node.Func.Signature
-			if node.Func.Parent() != nil {
-				sign = node.Func.Parent().Signature
+		// group by pkg
+		if groupPkg && !isFocused {
+			label := pkg.Name()
+			if goroot {
+				label = pkg.Path()
 			}
-
-			// omit type from label
-			if groupType && sign.Recv() != nil {
-				parts := strings.Split(label, ".")
-				label = parts[len(parts)-1]
+			key := pkg.Path()
+			if _, ok := c.Clusters[key]; !ok {
+				c.Clusters[key] = &dotCluster{
+					ID:       key,
+					Kind:     "pkg",
+					Clusters: make(map[string]*dotCluster),
+					Attrs: dotAttrs{
+						"penwidth":  "0.8",
+						"fontsize":  "16",
+						"label":     label,
+						"style":     "filled",
+						"fillcolor": "lightyellow",
+						"URL":       fmt.Sprintf("/?f=%s", key),
+						"fontname":  "Tahoma bold",
+						"tooltip":   fmt.Sprintf("package: %s", key),
+						"rank":      "sink",
+					},
+				}
+				if goroot {
+					c.Clusters[key].Attrs["fillcolor"] = "#E0FFE1"
+				}
 			}
+			c = c.Clusters[key]
+		}
+
+		// group by file
+		if groupFile && filename != "" {
+			c = fileCluster(c, filename, goroot)
+		}
+		return c
+	}
 
-			pkg, _ := build.Import(node.Func.Pkg.Pkg.Path(), "", 0)
-			// set node color
+	// typeCluster returns the cluster labelled label of the methods of
+	// recv in c, creating it
+	var typeCluster = func(c *dotCluster, recv types.Type, label string, goroot, isFocused bool, filename string) *dotCluster {
+		key := recv.String()
+		id := key
+		if groupFile {
+			// methods of a type may be spread over several files
+			id = fmt.Sprintf("%s@%s", key, filepath.Base(filename))
+		}
+		if _, ok := c.Clusters[key]; !ok {
+			c.Clusters[key] = &dotCluster{
+				ID:       id,
+				Kind:     "type",
+				Clusters: make(map[string]*dotCluster),
+				Attrs: dotAttrs{
+					"penwidth":  "0.5",
+					"fontsize":  "15",
+					"fontcolor": "#222222",
+					"label":     label,
+					"labelloc":  "b",
+					"style":     "rounded,filled",
+					"fillcolor": "wheat2",
+					"tooltip":   fmt.Sprintf("type: %s", key),
+				},
+			}
 			if isFocused {
-				attrs["fillcolor"] = "lightblue"
-			} else if pkg.Goroot {
-				attrs["fillcolor"] = "#adedad"
-			} else {
-				attrs["fillcolor"] = "moccasin"
+				c.Clusters[key].Attrs["fillcolor"] = "lightsteelblue"
+			} else if goroot {
+				c.Clusters[key].Attrs["fillcolor"] = "#c2e3c2"
 			}
-
-			// include pkg name
-			if !groupPkg && !isFocused {
-				label = fmt.Sprintf("%s\n%s", node.Func.Pkg.Pkg.Name(), label)
+			if t := namedType(recv); t != nil {
+				typeClusters[t] = append(typeClusters[t], c.Clusters[key])
 			}
+		}
+		return c.Clusters[key]
+	}
 
-			attrs["label"] = label
+	// sprintNode returns the node of a function of the program, or of the
+	// program of another build configuration, creating it on first use
+	var sprintNode = func(node *callgraph.Node) *dotNode {
+		// only once
+		key := node.Func.String()
+		if n, ok := nodeMap[key]; ok {
+			return n
+		}
 
-			// func styles
-			if node.Func.Parent() != nil {
-				attrs["style"] = "dotted,filled"
-			} else if node.Func.Object() != nil && node.Func.Object().Exported() {
-				attrs["penwidth"] = "1.5"
-			} else {
-				attrs["penwidth"] = "0.5"
-			}
+		fset := node.Func.Prog.Fset
+		pos := fset.Position(node.Func.Pos())
+		nodeTooltip := fmt.Sprintf("%s | defined in %s:%d", node.Func.String(), filepath.Base(pos.Filename), pos.Line)
 
-			c := cluster
+		// is focused
+		isFocused := focusPkg != nil &&
+			funcPkg(node.Func).Path() == focusPkg.Path()
+		attrs := make(dotAttrs)
 
-			// group by pkg
-			if groupPkg && !isFocused {
-				label := node.Func.Pkg.Pkg.Name()
-				if pkg.Goroot {
-					label = node.Func.Pkg.Pkg.Path()
-				}
-				key := node.Func.Pkg.Pkg.Path()
-				if _, ok := c.Clusters[key]; !ok {
-					c.Clusters[key] = &dotCluster{
-						ID:       key,
-						Clusters: make(map[string]*dotCluster),
-						Attrs: dotAttrs{
-							"penwidth":  "0.8",
-							"fontsize":  "16",
-							"label":     label,
-							"style":     "filled",
-							"fillcolor": "lightyellow",
-							"URL":       fmt.Sprintf("/?f=%s", key),
-							"fontname":  "Tahoma bold",
-							"tooltip":   fmt.Sprintf("package: %s", key),
-							"rank":      "sink",
-						},
-					}
-					if pkg.Goroot {
-						c.Clusters[key].Attrs["fillcolor"] = "#E0FFE1"
-					}
-				}
-				c = c.Clusters[key]
-			}
-
-			// group by type
-			if groupType && sign.Recv() != nil {
-				label := strings.Split(node.Func.RelString(node.Func.Pkg.Pkg), ".")[0]
-				key := sign.Recv().Type().String()
-				if _, ok := c.Clusters[key]; !ok {
-					c.Clusters[key] = &dotCluster{
-						ID:       key,
-						Clusters: make(map[string]*dotCluster),
-						Attrs: dotAttrs{
-							"penwidth":  "0.5",
-							"fontsize":  "15",
-							"fontcolor": "#222222",
-							"label":     label,
-							"labelloc":  "b",
-							"style":     "rounded,filled",
-							"fillcolor": "wheat2",
-							"tooltip":   fmt.Sprintf("type: %s", key),
-						},
-					}
-					if isFocused {
-						c.Clusters[key].Attrs["fillcolor"] = "lightsteelblue"
-					} else if pkg.Goroot {
-						c.Clusters[key].Attrs["fillcolor"] = "#c2e3c2"
-					}
-				}
-				c = c.Clusters[key]
-			}
+		// node label
+		label := funcLabel(node.Func, funcPkg(node.Func))
 
-			attrs["tooltip"] = nodeTooltip
+		// instantiations are grouped by their generic function if
+		// merged into it
+		declFn := node.Func
+		if opts.generics == "decl" && declFn.Origin() != nil {
+			declFn = declFn.Origin()
+		}
 
-			n := &dotNode{
-				ID:    node.Func.String(),
-				Attrs: attrs,
-			}
+		// func signature
+		sign := declFn.Signature
+		if declFn.Parent() != nil {
+			sign = declFn.Parent().Signature
+		}
 
-			if c != nil {
-				c.Nodes = append(c.Nodes, n)
-			} else {
-				nodes = append(nodes, n)
+		// label of the generic function the node is merged into
+		var genLabel string
+		if origin := node.Func.Origin(); origin != nil {
+			genLabel = genericLabel(origin, funcPkg(origin))
+		}
+
+		// omit type from label
+		if groupType && sign.Recv() != nil {
+			label, genLabel = trimRecv(label), trimRecv(genLabel)
+		}
+
+		pkg, _ := build.Import(funcPkg(node.Func).Path(), "", 0)
+		// set node color
+		if isFocused {
+			attrs["fillcolor"] = "lightblue"
+		} else if pkg.Goroot {
+			attrs["fillcolor"] = "#adedad"
+		} else {
+			attrs["fillcolor"] = "moccasin"
+		}
+
+		// color by test coverage
+		if covered, total, ok := opts.cov.funcCoverage(fset, node.Func); ok {
+			pct := 100 * float64(covered) / float64(total)
+			attrs["fillcolor"] = coverageColor(pct)
+			nodeTooltip = fmt.Sprintf("%s | coverage %.1f%% (%d/%d statements)", nodeTooltip, pct, covered, total)
+		}
+
+		// include pkg name
+		if !groupPkg && !isFocused {
+			label = fmt.Sprintf("%s\n%s", funcPkg(node.Func).Name(), label)
+		}
+
+		// weight by profile cost
+		if cum := opts.prof.cost(node.Func); cum > 0 {
+			flat := opts.prof.flat[node.Func.String()]
+			cost := fmt.Sprintf(
+				"%s (%.1f%%) of %s (%.1f%%)",
+				opts.prof.format(flat), opts.prof.percent(flat),
+				opts.prof.format(cum), opts.prof.percent(cum),
+			)
+			label = fmt.Sprintf("%s\n%s", label, cost)
+			attrs["fillcolor"] = heatColor(float64(cum) / float64(opts.prof.total))
+			attrs["fontsize"] = fmt.Sprintf("%.1f", 10+14*float64(flat)/float64(opts.prof.total))
+			nodeTooltip = fmt.Sprintf("%s | %s flat %s", nodeTooltip, opts.prof.sampleType, cost)
+		}
+
+		attrs["label"] = label
+
+		// func styles
+		if node.Func.Parent() != nil {
+			attrs["style"] = "dotted,filled"
+		} else if node.Func.Object() != nil && node.Func.Object().Exported() {
+			attrs["penwidth"] = "1.5"
+		} else {
+			attrs["penwidth"] = "0.5"
+		}
+
+		c := pkgCluster(funcPkg(node.Func), pkg.Goroot, isFocused, pos.Filename)
+
+		// group by type
+		if groupType && sign.Recv() != nil {
+			label := funcLabel(declFn, funcPkg(declFn))
+			if i := strings.Index(label, ")."); i >= 0 {
+				label = label[:i+1]
 			}
+			c = typeCluster(c, sign.Recv().Type(), label, pkg.Goroot, isFocused, pos.Filename)
+		}
 
-			nodeMap[key] = n
-			return n
+		attrs["tooltip"] = nodeTooltip
+
+		info := &nodeInfo{
+			Package:  funcPkg(node.Func).Path(),
+			Module:   moduleName(opts.modules[funcPkg(node.Func).Path()]),
+			File:     pos.Filename,
+			Line:     pos.Line,
+			Exported: node.Func.Object() != nil && node.Func.Object().Exported(),
+			Std:      pkg.Goroot,
+			Focused:  isFocused,
+			Lang:     "go",
+		}
+		if sign.Recv() != nil {
+			info.Type = sign.Recv().Type().String()
+		}
+		if origin := node.Func.Origin(); origin != nil {
+			info.Generic = origin.String()
+			genericLabels[info.Generic] = genLabel
+		}
+
+		n := &dotNode{
+			ID:    node.Func.String(),
+			Attrs: attrs,
+			Info:  info,
+		}
+
+		if c != nil {
+			c.Nodes = append(c.Nodes, n)
+		} else {
+			nodes = append(nodes, n)
+		}
+
+		nodeMap[key] = n
+		return n
+	}
+
+	count := 0
+	err := callgraph.GraphVisitEdges(cg, func(edge *callgraph.Edge) error {
+		count++
+		if opts.prof != nil || opts.trace != nil || opts.matrix != nil {
+			staticCalls[[2]string{edge.Caller.Func.String(), edge.Callee.Func.String()}] = true
 		}
-		callerNode := sprintNode(edge.Caller, true)
-		calleeNode := sprintNode(edge.Callee, false)
+
+		caller := edge.Caller
+		callee := edge.Callee
+
+		posCaller := prog.Fset.Position(caller.Func.Pos())
+		posEdge := prog.Fset.Position(edge.Pos())
+		//fileCaller := fmt.Sprintf("%s:%d", posCaller.Filename, posCaller.Line)
+		filenameCaller := filepath.Base(posCaller.Filename)
+
+		if omitCall(edge) {
+			return nil
+		}
+
+		callerPkg := funcPkg(caller.Func)
+		calleePkg := funcPkg(callee.Func)
+
+		//var buf bytes.Buffer
+		//data, _ := json.MarshalIndent(caller.Func, "", " ")
+		//logf("call node: %s -> %s\n %v", caller, callee, string(data))
+		logf("call node: %s -> %s (%s -> %s) %v\n", caller.Func.Pkg, callee.Func.Pkg, caller, callee, filenameCaller)
+
+		callerNode := sprintNode(edge.Caller)
+		calleeNode := sprintNode(edge.Callee)
 
 		// edges
 		attrs := make(dotAttrs)
+		info := &edgeInfo{Kind: "call"}
 
 		// dynamic call
 		if edge.Site != nil && edge.Site.Common().StaticCallee() == nil {
 			attrs["style"] = "dashed"
+			info.Dynamic = true
 		}
 
 		// go & defer calls
 		switch edge.Site.(type) {
 		case *ssa.Go:
 			attrs["arrowhead"] = "normalnoneodot"
+			info.Kind = "go"
 		case *ssa.Defer:
 			attrs["arrowhead"] = "normalnoneodiamond"
+			info.Kind = "defer"
 		}
+		posSite := fmt.Sprintf("%s:%d", posEdge.Filename, posEdge.Line)
 
 		// colorize calls outside focused pkg
 		if focusPkg != nil &&
@@ -408,18 +735,136 @@ func printOutput(
 			posEdge.Line,
 			edge.Callee.Func.String(),
 		)
+		expr := exprs.text(edge.Site)
+		if expr != "" {
+			fileEdge = fmt.Sprintf("%s in %s", fileEdge, expr)
+		}
+
+		// goroutines start at the node of their spawn site
+		if site, ok := edge.Site.(*ssa.Go); ok && opts.conc != nil {
+			spawn := spawnNode(site)
+			key := fmt.Sprintf("%s => %s", caller.Func, spawn.ID)
+			if _, ok := edgeMap[key]; !ok {
+				attrs["tooltip"] = fmt.Sprintf("at %s:%d: spawning goroutine", filepath.Base(posEdge.Filename), posEdge.Line)
+				info.Positions = []string{posSite}
+				edgeMap[key] = &dotEdge{
+					From:  callerNode,
+					To:    spawn,
+					Attrs: attrs,
+					Info:  info,
+				}
+			}
+			key = fmt.Sprintf("%s => %s", spawn.ID, callee.Func)
+			if _, ok := edgeMap[key]; ok {
+				return nil
+			}
+			spawnAttrs := dotAttrs{
+				"tooltip": fmt.Sprintf("goroutine running [%s]", callee.Func),
+			}
+			if info.Dynamic {
+				spawnAttrs["style"] = "dashed"
+			}
+			edgeMap[key] = &dotEdge{
+				From:  spawn,
+				To:    calleeNode,
+				Attrs: spawnAttrs,
+				Info:  &edgeInfo{Kind: "call", Dynamic: info.Dynamic, Positions: []string{posSite}},
+			}
+			return nil
+		}
 
-		// omit duplicate calls, except for tooltip enhancements
+		// interface method calls go through the node of the method
+		if opts.dispatch && edge.Site != nil && edge.Site.Common().IsInvoke() {
+			dispNode := dispatchNode(edge.Site.Common())
+			key := fmt.Sprintf("%s => %s", caller.Func, dispNode.ID)
+			e, ok := edgeMap[key]
+			if !ok {
+				info.Dynamic = true
+				e = &dotEdge{
+					From:  callerNode,
+					To:    dispNode,
+					Attrs: attrs,
+					Info:  info,
+				}
+				edgeMap[key] = e
+			}
+			if !dispatchSites[edge.Site] {
+				dispatchSites[edge.Site] = true
+				n := siteImpls(edge)
+				siteTooltip := fmt.Sprintf(
+					"at %s:%d: %d implementations of %s",
+					filepath.Base(posEdge.Filename),
+					posEdge.Line,
+					n,
+					dispNode.Attrs["label"],
+				)
+				e.Info.Positions = append(e.Info.Positions, posSite)
+				if e.Attrs["tooltip"] == "" {
+					e.Attrs["tooltip"] = siteTooltip
+				} else {
+					e.Attrs["tooltip"] += "\n" + siteTooltip
+				}
+				r, ok := dispatchImpls[e]
+				if !ok || n < r[0] {
+					r[0] = n
+				}
+				if n > r[1] {
+					r[1] = n
+				}
+				dispatchImpls[e] = r
+			}
+
+			key = fmt.Sprintf("%s => %s", dispNode.ID, callee.Func)
+			if e, ok := edgeMap[key]; ok {
+				e.Info.Positions = append(e.Info.Positions, posSite)
+				for _, path := range opts.promoted.paths(edge) {
+					addVia(e, path)
+				}
+				return nil
+			}
+			implAttrs := dotAttrs{
+				"style":   "dashed",
+				"tooltip": fmt.Sprintf("implemented by %s", callee.Func),
+			}
+			if c, ok := attrs["color"]; ok {
+				implAttrs["color"] = c
+			}
+			edgeMap[key] = &dotEdge{
+				From:  dispNode,
+				To:    calleeNode,
+				Attrs: implAttrs,
+				Info:  &edgeInfo{Kind: "dispatch", Dynamic: true, Positions: []string{posSite}},
+			}
+			for _, path := range opts.promoted.paths(edge) {
+				addVia(edgeMap[key], path)
+			}
+			return nil
+		}
+
+		// omit duplicate calls, except for tooltip enhancements, unless
+		// each call site gets its own edge
 		key := fmt.Sprintf("%s = %s => %s", caller.Func, edge.Description(), callee.Func)
+		if opts.callSites == "each" {
+			key = fmt.Sprintf("%s @ %s:%d", key, posSite, posEdge.Column)
+			if expr != "" {
+				attrs["label"] = expr
+				attrs["fontsize"] = "10"
+			}
+		}
 		if _, ok := edgeMap[key]; !ok {
 			attrs["tooltip"] = fileEdge
+			info.Positions = []string{posSite}
 			e := &dotEdge{
 				From:  callerNode,
 				To:    calleeNode,
 				Attrs: attrs,
+				Info:  info,
 			}
 			edgeMap[key] = e
-		} else {
+			edgeSites[e] = map[token.Pos]bool{edge.Pos(): true}
+		} else if !edgeSites[edgeMap[key]][edge.Pos()] {
+			edgeSites[edgeMap[key]][edge.Pos()] = true
+			edgeMap[key].Info.Positions = append(edgeMap[key].Info.Positions, posSite)
 			// make sure, tooltip is created correctly
 			if _, okk := edgeMap[key].Attrs["tooltip"]; !okk {
 				edgeMap[key].Attrs["tooltip"] = fileEdge
@@ -432,6 +877,11 @@ func printOutput(
 			}
 		}
 
+		// calls of methods promoted from embedded fields
+		for _, path := range opts.promoted.paths(edge) {
+			addVia(edgeMap[key], path)
+		}
+
 		return nil
 	})
 	if err != nil {
@@ -450,6 +900,362 @@ func printOutput(
 
 	logf("%d/%d edges", len(edges), count)
 
+	// label merged calls with their number of call sites
+	if opts.callSites == "count" {
+		for _, e := range edges {
+			if e.Info.Kind == "dispatch" || e.To.Info != nil && e.To.Info.Kind == "spawn" {
+				continue
+			}
+			if n := len(e.Info.Positions); n > 1 {
+				e.Attrs["label"] = fmt.Sprintf("%d calls", n)
+				e.Attrs["fontsize"] = "10"
+			}
+		}
+	}
+
+	// weight calls by their cost in the profile and add the calls of the
+	// profile missing in the static call graph
+	if opts.prof != nil {
+		var max int64
+		for _, v := range opts.prof.calls {
+			if v > max {
+				max = v
+			}
+		}
+		for _, e := range edges {
+			v := opts.prof.calls[[2]string{e.From.ID, e.To.ID}]
+			if v == 0 {
+				continue
+			}
+			cost := opts.prof.format(v)
+			if e.Attrs["label"] == "" {
+				e.Attrs["label"] = cost
+			} else {
+				e.Attrs["label"] += "\n" + cost
+			}
+			e.Attrs["penwidth"] = fmt.Sprintf("%.1f", 1+5*float64(v)/float64(max))
+			e.Attrs["weight"] = fmt.Sprint(1 + 10*v/max)
+			e.Attrs["tooltip"] = fmt.Sprintf("%s\n%s %s (%.1f%%)", e.Attrs["tooltip"], opts.prof.sampleType, cost, opts.prof.percent(v))
+		}
+
+		var missing [][2]string
+		for call := range opts.prof.calls {
+			if !staticCalls[call] {
+				missing = append(missing, call)
+			}
+		}
+		sortCalls(missing)
+		for _, call := range missing {
+			logf("profile only: %s -> %s", call[0], call[1])
+			from, ok := nodeMap[call[0]]
+			to, ok2 := nodeMap[call[1]]
+			if !ok || !ok2 {
+				continue
+			}
+			v := opts.prof.calls[call]
+			edges = append(edges, &dotEdge{
+				From: from,
+				To:   to,
+				Attrs: dotAttrs{
+					"label":      fmt.Sprintf("profile only: %s", opts.prof.format(v)),
+					"style":      "dashed,bold",
+					"color":      "#d62728",
+					"fontcolor":  "#d62728",
+					"fontsize":   "10",
+					"constraint": "false",
+					"tooltip":    fmt.Sprintf("%s -> %s\n%s %s (%.1f%%), not in the static call graph", call[0], call[1], opts.prof.sampleType, opts.prof.format(v), opts.prof.percent(v)),
+				},
+				Info: &edgeInfo{Kind: "profile", Dynamic: true},
+			})
+		}
+		logf("%d calls of the profile missing in the static call graph", len(missing))
+	}
+
+	// mark the dynamic calls observed at runtime, fade the others and add
+	// the observed calls missing in the static call graph
+	if opts.trace != nil {
+		// calls through dispatch and spawn nodes are observed between the
+		// functions around them
+		ins := make(map[*dotNode][]*dotNode)
+		outs := make(map[*dotNode][]*dotNode)
+		for _, e := range edges {
+			ins[e.To] = append(ins[e.To], e.From)
+			outs[e.From] = append(outs[e.From], e.To)
+		}
+		var funcs = func(n *dotNode, next map[*dotNode][]*dotNode) []*dotNode {
+			if n.Info != nil && (n.Info.Kind == "dispatch" || n.Info.Kind == "spawn") {
+				return next[n]
+			}
+			return []*dotNode{n}
+		}
+		var observed = func(e *dotEdge) bool {
+			for _, from := range funcs(e.From, ins) {
+				for _, to := range funcs(e.To, outs) {
+					if opts.trace.calls[[2]string{from.ID, to.ID}] {
+						return true
+					}
+				}
+			}
+			return false
+		}
+		seen, unseen := 0, 0
+		for _, e := range edges {
+			if e.Info == nil || !e.Info.Dynamic || (e.Info.Kind != "call" && e.Info.Kind != "dispatch") {
+				continue
+			}
+			if observed(e) {
+				seen++
+				e.Attrs["color"] = "#1a9850"
+				e.Attrs["penwidth"] = "2"
+				e.Attrs["style"] = "solid"
+				e.Attrs["tooltip"] += "\nobserved at runtime"
+			} else {
+				unseen++
+				e.Attrs["color"] = "#cccccc"
+				e.Attrs["fontcolor"] = "#aaaaaa"
+				e.Attrs["tooltip"] += "\nnot observed at runtime"
+			}
+		}
+		logf("%d/%d dynamic calls observed at runtime", seen, seen+unseen)
+
+		var missing [][2]string
+		for call := range opts.trace.calls {
+			if !staticCalls[call] {
+				missing = append(missing, call)
+			}
+		}
+		sortCalls(missing)
+		for _, call := range missing {
+			logf("runtime only: %s -> %s", call[0], call[1])
+			from, ok := nodeMap[call[0]]
+			to, ok2 := nodeMap[call[1]]
+			if !ok || !ok2 {
+				continue
+			}
+			edges = append(edges, &dotEdge{
+				From: from,
+				To:   to,
+				Attrs: dotAttrs{
+					"label":      "runtime only",
+					"style":      "dashed,bold",
+					"color":      "#ff7f0e",
+					"fontcolor":  "#ff7f0e",
+					"fontsize":   "10",
+					"constraint": "false",
+					"tooltip":    fmt.Sprintf("%s -> %s\nobserved at runtime, not in the static call graph", call[0], call[1]),
+				},
+				Info: &edgeInfo{Kind: "runtime", Dynamic: true},
+			})
+		}
+		logf("%d calls observed at runtime missing in the static call graph", len(missing))
+	}
+
+	// mark the calls made in some build configurations only and add the
+	// calls of the other configurations missing in this one
+	if opts.matrix != nil {
+		for _, e := range edges {
+			if e.From.Info == nil || e.From.Info.Kind != "" || e.To.Info == nil || e.To.Info.Kind != "" {
+				continue
+			}
+			cfgs := opts.matrix.only([2]string{e.From.ID, e.To.ID})
+			if cfgs == nil {
+				continue
+			}
+			only := "only " + strings.Join(cfgs, ", ")
+			if e.Attrs["label"] == "" {
+				e.Attrs["label"] = only
+			} else {
+				e.Attrs["label"] += "\n" + only
+			}
+			e.Attrs["color"] = "#6a3d9a"
+			e.Attrs["fontcolor"] = "#6a3d9a"
+			e.Attrs["fontsize"] = "10"
+			e.Attrs["tooltip"] += "\nonly in " + strings.Join(cfgs, ", ")
+		}
+
+		var missing [][2]string
+		for call := range opts.matrix.calls {
+			if !staticCalls[call] {
+				missing = append(missing, call)
+			}
+		}
+		sortCalls(missing)
+		logf("%d calls of other build configurations only", len(missing))
+
+		// the functions of other configurations only get their node here,
+		// in the cluster of their package
+		omitted := 0
+		for _, call := range missing {
+			edge := opts.matrix.edges[call]
+			if omitCall(edge) {
+				logf("platform only, omitted: %s -> %s", call[0], call[1])
+				omitted++
+				continue
+			}
+			from := sprintNode(edge.Caller)
+			to := sprintNode(edge.Callee)
+			cfgs := opts.matrix.calls[call]
+			logf("platform only: %s -> %s in %v", call[0], call[1], cfgs)
+			edges = append(edges, &dotEdge{
+				From: from,
+				To:   to,
+				Attrs: dotAttrs{
+					"label":     "only " + strings.Join(cfgs, ", "),
+					"style":     "dashed",
+					"color":     "#6a3d9a",
+					"fontcolor": "#6a3d9a",
+					"fontsize":  "10",
+					"tooltip":   fmt.Sprintf("%s -> %s\nonly in %s", call[0], call[1], strings.Join(cfgs, ", ")),
+				},
+				Info: &edgeInfo{Kind: "platform"},
+			})
+		}
+		if omitted > 0 {
+			log.Printf("%d calls of other build configurations only omitted by the filters", omitted)
+		}
+
+		// mark the functions of some configurations only, of this one too
+		for name, n := range nodeMap {
+			if n.Info == nil || n.Info.Kind != "" {
+				continue
+			}
+			if cfgs := opts.matrix.onlyFunc(name); cfgs != nil {
+				n.Attrs["color"] = "#6a3d9a"
+				n.Attrs["style"] = "dashed,filled"
+				n.Attrs["tooltip"] += " | only in " + strings.Join(cfgs, ", ")
+			}
+		}
+	}
+
+	// function values passed from where they are created to their calls
+	passes := make(map[string]*dotEdge)
+	for _, f := range opts.flows {
+		from, ok := nodeMap[f.creator.String()]
+		to, ok2 := nodeMap[f.fn.String()]
+		if !ok || !ok2 || f.creator == f.site.Parent() {
+			continue
+		}
+		name := f.fn.String()
+		if pkg := funcPkg(f.fn); pkg != nil {
+			name = f.fn.RelString(pkg)
+		}
+		posValue := prog.Fset.Position(f.pos)
+		posCall := prog.Fset.Position(f.site.Pos())
+		tooltip := fmt.Sprintf(
+			"at %s:%d: passing [%s], called at %s:%d in [%s]",
+			filepath.Base(posValue.Filename),
+			posValue.Line,
+			f.fn,
+			filepath.Base(posCall.Filename),
+			posCall.Line,
+			f.site.Parent(),
+		)
+		key := fmt.Sprintf("%s => %s", from.ID, to.ID)
+		e, ok := passes[key]
+		if !ok {
+			e = &dotEdge{
+				From: from,
+				To:   to,
+				Attrs: dotAttrs{
+					"label":      fmt.Sprintf("passes %s", name),
+					"style":      "dotted",
+					"color":      "#1f78b4",
+					"fontcolor":  "#1f78b4",
+					"fontsize":   "10",
+					"arrowhead":  "empty",
+					"constraint": "false",
+					"tooltip":    tooltip,
+				},
+				Info: &edgeInfo{Kind: "passes", Dynamic: true},
+			}
+			passes[key] = e
+			edges = append(edges, e)
+		} else if !strings.Contains(e.Attrs["tooltip"], tooltip) {
+			e.Attrs["tooltip"] += "\n" + tooltip
+		}
+		posSite := fmt.Sprintf("%s:%d", posValue.Filename, posValue.Line)
+		if len(e.Info.Positions) == 0 || e.Info.Positions[len(e.Info.Positions)-1] != posSite {
+			e.Info.Positions = append(e.Info.Positions, posSite)
+		}
+	}
+
+	// label calls of promoted methods with their embedding paths
+	for e, paths := range viaPaths {
+		via := "via " + strings.Join(paths, ", ")
+		if e.Attrs["label"] == "" {
+			e.Attrs["label"] = via
+		} else {
+			e.Attrs["label"] += "\n" + via
+		}
+		e.Attrs["fontsize"] = "10"
+		e.Attrs["tooltip"] = fmt.Sprintf("%s\npromoted method, %s", e.Attrs["tooltip"], via)
+	}
+	if opts.promoted != nil && groupType {
+		// the types along the promotion paths without methods in the
+		// graph get a cluster too, for the embeds edges to follow the
+		// paths
+		var noMethods []*types.TypeName
+		for t := range pathTypes {
+			if _, ok := typeClusters[t]; !ok && t.Pkg() != nil {
+				noMethods = append(noMethods, t)
+			}
+		}
+		sort.Slice(noMethods, func(i, j int) bool {
+			return noMethods[i].Type().String() < noMethods[j].Type().String()
+		})
+		for _, t := range noMethods {
+			pkg, _ := build.Import(t.Pkg().Path(), "", 0)
+			isFocused := focusPkg != nil && t.Pkg().Path() == focusPkg.Path()
+			pos := prog.Fset.Position(t.Pos())
+			c := pkgCluster(t.Pkg(), pkg.Goroot, isFocused, pos.Filename)
+			c = typeCluster(c, t.Type(), fmt.Sprintf("(%s)", t.Name()), pkg.Goroot, isFocused, pos.Filename)
+			c.Nodes = append(c.Nodes, &dotNode{
+				ID: "type:" + t.Type().String(),
+				Attrs: dotAttrs{
+					"label":    t.Name(),
+					"style":    "dashed",
+					"fontsize": "10",
+					"tooltip":  fmt.Sprintf("type: %s | declared in %s:%d, promotes the methods of its embedded fields", t.Type(), filepath.Base(pos.Filename), pos.Line),
+				},
+				Info: &nodeInfo{
+					Package:  t.Pkg().Path(),
+					Module:   moduleName(opts.modules[t.Pkg().Path()]),
+					Type:     t.Type().String(),
+					File:     pos.Filename,
+					Line:     pos.Line,
+					Exported: t.Exported(),
+					Std:      pkg.Goroot,
+					Focused:  isFocused,
+					Lang:     "go",
+					Kind:     "type",
+				},
+			})
+		}
+		edges = append(edges, embedsEdges(typeClusters)...)
+	}
+
+	// label dispatch edges with the implementations resolved per site
+	for e, r := range dispatchImpls {
+		if r[0] == r[1] {
+			e.Attrs["label"] = fmt.Sprintf("%d impls", r[0])
+		} else {
+			e.Attrs["label"] = fmt.Sprintf("%d-%d impls", r[0], r[1])
+		}
+	}
+	for _, n := range dispatchNodes {
+		impls := 0
+		for _, e := range edges {
+			if e.From == n {
+				impls++
+			}
+		}
+		n.Attrs["label"] = fmt.Sprintf("%s\n(%d impls)", n.Attrs["label"], impls)
+	}
+
+	if groupDir {
+		compactDirs(cluster)
+	}
+
 	dotg := &dotGraph{
 		Title:   mainPkg.Path(),
 		Minlen:  minlen,
@@ -462,27 +1268,45 @@ func printOutput(
 			"nodeshape": fmt.Sprint(nodeshape),
 			"nodestyle": fmt.Sprint(nodestyle),
 			"rankdir":   fmt.Sprint(rankdir),
+			"compound":  fmt.Sprint(opts.promoted != nil && groupType),
 		},
 	}
 
+	// channels and sync calls of the functions in the graph
+	if opts.conc != nil {
+		opts.conc.view(prog, dotg, nodeMap, focusPkg, cluster)
+	}
+
+	// one node per generic function instead of per instantiation
+	if opts.generics == "decl" {
+		mergeInstances(dotg, genericLabels)
+	}
+
 	///MYCODE
+	var cConfigs []*cConfig
 	if *c_root_path != "" {
 		*c_root_path = addSlash(*c_root_path)
-		if err = genCdotCallgraph(prog); err != nil {
+		if cConfigs, err = genCdotCallgraph(prog); err != nil {
 			return nil, err
 		}
-		*c_dot_path = absDefaultDotPath
+	} else if *c_dot_path != "" {
+		cConfigs = []*cConfig{{dotPath: *c_dot_path, llPath: *c_ll_path}}
 	}
-	if *c_dot_path != "" {
-		dotg = addCGOdotGraph(prog, dotg)
+	if len(cConfigs) > 0 {
+		dotg = addCGOdotGraph(prog, dotg, cConfigs, &cgoFilter{
+			focusPkg: focusPkg,
+			keepGo: func(fn *ssa.Function) bool {
+				return inFilters(&callgraph.Node{Func: fn})
+			},
+			ignore: opts.cignorePatterns,
+			noclib: opts.noclib,
+		})
 	}
-
-	var buf bytes.Buffer
-	if err := dotg.WriteDot(&buf); err != nil {
-		return nil, err
+	if *c_root_path != "" {
+		dotg.Warning = cgoFailures.Warning()
 	}
 
-	return buf.Bytes(), nil
+	return dotg, nil
 }
 
 ///MYCODE
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var plantumlEscaper = strings.NewReplacer(
+	`"`, "'",
+	"\n", `\n`,
+)
+
+// plantumlText quotes s for use as a PlantUML element or package name.
+func plantumlText(s string) string {
+	return `"` + plantumlEscaper.Replace(s) + `"`
+}
+
+// plantumlColor returns c in PlantUML's #name or #rrggbb notation.
+func plantumlColor(c string) string {
+	return "#" + strings.TrimPrefix(cssColor(c), "#")
+}
+
+type plantumlWriter struct {
+	w     *bufio.Writer
+	ids   map[*dotNode]string
+	nodes int
+	subs  int
+}
+
+func (p *plantumlWriter) node(n *dotNode, indent string) {
+	id := fmt.Sprintf("n%d", p.nodes)
+	p.nodes++
+	p.ids[n] = id
+
+	label := n.Attrs["label"]
+	if label == "" {
+		label = n.ID
+	}
+	elem := "rectangle"
+	if n.Attrs["shape"] == "ellipse" {
+		elem = "usecase"
+	}
+
+	// exported: bold border, unexported: normal, anonymous: dotted
+	var style []string
+	if c := n.Attrs["fillcolor"]; c != "" {
+		style = append(style, plantumlColor(c))
+	}
+	switch s := n.Attrs["style"]; {
+	case strings.Contains(s, "dotted"):
+		style = append(style, "line.dotted")
+	case strings.Contains(s, "dashed"):
+		style = append(style, "line.dashed")
+	case n.Attrs["penwidth"] == "1.5":
+		style = append(style, "line.bold")
+	}
+	fmt.Fprintf(p.w, "%s%s %s as %s %s\n", indent, elem, plantumlText(label), id, strings.Join(style, ";"))
+}
+
+func (p *plantumlWriter) cluster(c *dotCluster, indent string) {
+	id := fmt.Sprintf("s%d", p.subs)
+	p.subs++
+
+	// modules, directories and packages are drawn as packages, types and
+	// files as rectangles
+	elem := "rectangle"
+	switch c.Kind {
+	case "focus", "module", "dir", "pkg", "cgo":
+		elem = "package"
+	}
+	fill := c.Attrs["fillcolor"]
+	if fill == "" {
+		fill = c.Attrs["bgcolor"]
+	}
+	if fill != "" {
+		fill = " " + plantumlColor(fill)
+	}
+	fmt.Fprintf(p.w, "%s%s %s as %s%s {\n", indent, elem, plantumlText(c.Attrs["label"]), id, fill)
+	p.clusterBody(c, indent+"  ")
+	fmt.Fprintf(p.w, "%s}\n", indent)
+}
+
+func (p *plantumlWriter) clusterBody(c *dotCluster, indent string) {
+	for _, n := range sortedNodes(c.Nodes) {
+		p.node(n, indent)
+	}
+	for _, sub := range c.sortedClusters() {
+		p.cluster(sub, indent)
+	}
+}
+
+// WritePlantUML writes the graph as a PlantUML component diagram. Package
+// clusters become packages, type clusters rectangles and the edge styles
+// of the legend are kept as arrow styles and go/defer labels.
+func (g *dotGraph) WritePlantUML(w io.Writer) error {
+	p := &plantumlWriter{
+		w:   bufio.NewWriter(w),
+		ids: make(map[*dotNode]string),
+	}
+
+	fmt.Fprintln(p.w, "@startuml")
+	title := g.Title
+	if g.Warning != "" {
+		title = fmt.Sprintf("%s\n%s", g.Warning, title)
+	}
+	fmt.Fprintf(p.w, "title %s\n", plantumlEscaper.Replace(title))
+	// PlantUML only lays out top to bottom or left to right
+	switch g.Options["rankdir"] {
+	case "TB", "BT":
+		fmt.Fprintln(p.w, "top to bottom direction")
+	default:
+		fmt.Fprintln(p.w, "left to right direction")
+	}
+	fmt.Fprintln(p.w, "skinparam shadowing false")
+	fmt.Fprintln(p.w, "skinparam defaultFontName Verdana")
+	if strings.Contains(nodestyle, "rounded") {
+		fmt.Fprintln(p.w, "skinparam roundCorner 10")
+	}
+
+	if g.Cluster != nil {
+		// the root cluster is only drawn when it is labelled by focus
+		if g.Cluster.Attrs["label"] != "" {
+			p.cluster(g.Cluster, "")
+		} else {
+			p.clusterBody(g.Cluster, "")
+		}
+	}
+	if g.CCluster != nil {
+		p.cluster(g.CCluster, "")
+	}
+	for _, n := range sortedNodes(g.Nodes) {
+		p.node(n, "")
+	}
+
+	for _, e := range g.sortedEdges() {
+		for _, n := range []*dotNode{e.From, e.To} {
+			if _, ok := p.ids[n]; !ok {
+				p.node(n, "")
+			}
+		}
+
+		var style []string
+		if c := e.Attrs["color"]; c != "" {
+			style = append(style, plantumlColor(c))
+		}
+		if e.dashed() {
+			style = append(style, "dashed")
+		} else if strings.Contains(e.Attrs["style"], "bold") {
+			style = append(style, "bold")
+		}
+		arrow := "-->"
+		if len(style) > 0 {
+			arrow = "-[" + strings.Join(style, ",") + "]->"
+		}
+
+		fmt.Fprintf(p.w, "%s %s %s", p.ids[e.From], arrow, p.ids[e.To])
+		if labels := e.labels(); len(labels) > 0 {
+			fmt.Fprintf(p.w, " : %s", plantumlEscaper.Replace(strings.Join(labels, " ")))
+		}
+		fmt.Fprintln(p.w)
+	}
+
+	fmt.Fprintln(p.w, "@enduml")
+	return p.w.Flush()
+}
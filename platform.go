@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ofabry/go-callvis/internal/pointer"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/packages"
+)
+
+// buildConfig is a build configuration the packages are loaded in.
+type buildConfig struct {
+	Name   string
+	GOOS   string // empty for the host
+	GOARCH string // empty for the host
+	Tags   []string
+}
+
+// packagesConfig returns the configuration loading the packages in dir
+// for c.
+func (c *buildConfig) packagesConfig(dir string, tests bool) *packages.Config {
+	cfg := &packages.Config{
+		Mode:  packages.LoadAllSyntax | packages.NeedModule,
+		Tests: tests,
+		Dir:   dir,
+	}
+	if c.GOOS != "" || c.GOARCH != "" {
+		cfg.Env = os.Environ()
+		if c.GOOS != "" {
+			cfg.Env = append(cfg.Env, "GOOS="+c.GOOS)
+		}
+		if c.GOARCH != "" {
+			cfg.Env = append(cfg.Env, "GOARCH="+c.GOARCH)
+		}
+	}
+	if len(c.Tags) > 0 {
+		cfg.BuildFlags = []string{"-tags=" + strings.Join(c.Tags, ",")}
+	}
+	return cfg
+}
+
+// getBuildConfigs returns the build configurations of -goos and -goarch,
+// one for each pair of their comma separated values, with the tags of
+// -tags, or the configurations of -buildconfig values like linux/amd64 or
+// windows/arm64,purego which add their tags to the ones of -tags.
+func getBuildConfigs() ([]*buildConfig, error) {
+	if len(BuildConfigs) == 0 {
+		goos, goarch := splitList(*goosFlag), splitList(*goarchFlag)
+		if len(goos) <= 1 && len(goarch) <= 1 {
+			return []*buildConfig{{
+				GOOS:   *goosFlag,
+				GOARCH: *goarchFlag,
+				Tags:   tagsFlag,
+			}}, nil
+		}
+		if len(goos) == 0 {
+			goos = []string{""}
+		}
+		if len(goarch) == 0 {
+			goarch = []string{""}
+		}
+		var configs []*buildConfig
+		for _, sys := range goos {
+			for _, arch := range goarch {
+				name := sys + "/" + arch
+				if sys == "" || arch == "" {
+					name = sys + arch
+				}
+				configs = append(configs, &buildConfig{
+					Name:   name,
+					GOOS:   sys,
+					GOARCH: arch,
+					Tags:   tagsFlag,
+				})
+			}
+		}
+		return configs, nil
+	}
+	if *goosFlag != "" || *goarchFlag != "" {
+		return nil, fmt.Errorf("-goos and -goarch cannot be used with -buildconfig")
+	}
+	var configs []*buildConfig
+	names := make(map[string]bool)
+	for _, v := range BuildConfigs {
+		parts := strings.Split(v, ",")
+		platform := strings.Split(strings.TrimSpace(parts[0]), "/")
+		if len(platform) != 2 || platform[0] == "" || platform[1] == "" {
+			return nil, fmt.Errorf("invalid build configuration %q, want goos/goarch[,tag...]", v)
+		}
+		if names[v] {
+			return nil, fmt.Errorf("duplicate build configuration %q", v)
+		}
+		names[v] = true
+		tags := append([]string{}, tagsFlag...)
+		for _, t := range parts[1:] {
+			if t = strings.TrimSpace(t); t != "" {
+				tags = append(tags, t)
+			}
+		}
+		configs = append(configs, &buildConfig{
+			Name:   v,
+			GOOS:   platform[0],
+			GOARCH: platform[1],
+			Tags:   tags,
+		})
+	}
+	return configs, nil
+}
+
+// splitList returns the non-empty comma separated values of s.
+func splitList(s string) []string {
+	var l []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			l = append(l, v)
+		}
+	}
+	return l
+}
+
+// buildMatrix holds the calls of the call graph of each build
+// configuration, to tell the calls made on some platforms only.
+type buildMatrix struct {
+	configs []*buildConfig
+	calls   map[[2]string][]string        // names of the configurations by call
+	funcs   map[string][]string           // names of the configurations by function
+	edges   map[[2]string]*callgraph.Edge // edge of the first configuration by call
+}
+
+// add adds the calls of cg, the call graph of bc.
+func (m *buildMatrix) add(bc *buildConfig, cg *callgraph.Graph) {
+	cg.DeleteSyntheticNodes()
+	var addFunc = func(name string) {
+		if cfgs := m.funcs[name]; len(cfgs) == 0 || cfgs[len(cfgs)-1] != bc.Name {
+			m.funcs[name] = append(cfgs, bc.Name)
+		}
+	}
+	callgraph.GraphVisitEdges(cg, func(edge *callgraph.Edge) error {
+		if isSynthetic(edge) {
+			return nil
+		}
+		call := [2]string{edge.Caller.Func.String(), edge.Callee.Func.String()}
+		if cfgs := m.calls[call]; len(cfgs) == 0 || cfgs[len(cfgs)-1] != bc.Name {
+			m.calls[call] = append(cfgs, bc.Name)
+		}
+		if _, ok := m.edges[call]; !ok {
+			m.edges[call] = edge
+		}
+		addFunc(call[0])
+		addFunc(call[1])
+		return nil
+	})
+}
+
+// only returns the configurations making call if not all of them do.
+func (m *buildMatrix) only(call [2]string) []string {
+	if cfgs := m.calls[call]; len(cfgs) < len(m.configs) {
+		return cfgs
+	}
+	return nil
+}
+
+// onlyFunc returns the configurations having the function named name if
+// not all of them do.
+func (m *buildMatrix) onlyFunc(name string) []string {
+	if cfgs := m.funcs[name]; len(cfgs) < len(m.configs) {
+		return cfgs
+	}
+	return nil
+}
+
+// reach adds to reach the functions called from it in any configuration,
+// for the calls of other configurations to be kept by -tests. As in
+// testReach, the calls of the testing package are not followed.
+func (m *buildMatrix) reach(reach map[string]bool) {
+	for added := true; added; {
+		added = false
+		for call, edge := range m.edges {
+			if !reach[call[0]] || reach[call[1]] {
+				continue
+			}
+			if pkg := funcPkg(edge.Callee.Func); pkg != nil && pkg.Path() == "testing" {
+				continue
+			}
+			reach[call[1]] = true
+			added = true
+		}
+	}
+}
+
+// analyzeCallGraph loads and analyzes the packages of args in bc and
+// returns their call graph.
+func analyzeCallGraph(bc *buildConfig, dir string, tests bool, args []string) (*callgraph.Graph, error) {
+	_, _, _, mains, err := loadProgram(bc, dir, tests, args)
+	if err != nil {
+		return nil, err
+	}
+	result, err := pointer.Analyze(&pointer.Config{
+		Mains:          mains,
+		BuildCallGraph: true,
+	})
+	if err != nil {
+		return nil, err // internal error in pointer analysis
+	}
+	return result.CallGraph, nil
+}
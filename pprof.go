@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// pprofData holds the cost of the functions of a pprof profile, mapped to
+// the functions of the program by their ssa.Function.String().
+type pprofData struct {
+	sampleType string
+	unit       string
+	total      int64
+	flat       map[string]int64
+	cum        map[string]int64
+	calls      map[[2]string]int64 // cost of calls from caller to callee
+	unmapped   int                 // profile functions not in the program
+}
+
+// readPprof reads the profile at path, weighting functions by the default
+// sample type of the profile (e.g. cpu time or in-use heap space).
+func readPprof(prog *ssa.Program, path string) (*pprofData, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading profile: %v", err)
+	}
+	defer f.Close()
+	p, err := profile.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading profile %s: %v", path, err)
+	}
+	if len(p.SampleType) == 0 {
+		return nil, fmt.Errorf("reading profile %s: no sample types", path)
+	}
+	return newPprofData(p, pprofNames(prog)), nil
+}
+
+// pprofNames maps the symbol names of the functions of prog, as found in
+// profiles and returned by runtime.FuncForPC, to their
+// ssa.Function.String().
+func pprofNames(prog *ssa.Program) map[string]string {
+	names := make(map[string]string)
+	for fn := range ssautil.AllFunctions(prog) {
+		// the instantiations of a generic function share their symbol,
+		// its cost goes to the first of them
+		if name := pprofName(fn); name != "" {
+			if s, ok := names[name]; !ok || fn.String() < s {
+				names[name] = fn.String()
+			}
+		}
+	}
+	return names
+}
+
+// newPprofData returns the costs of p, mapped to functions by names.
+func newPprofData(p *profile.Profile, names map[string]string) *pprofData {
+
+	// index of the sample value, the last one unless a default is given
+	idx := len(p.SampleType) - 1
+	for i, st := range p.SampleType {
+		if st.Type == p.DefaultSampleType {
+			idx = i
+		}
+	}
+
+	d := &pprofData{
+		sampleType: p.SampleType[idx].Type,
+		unit:       p.SampleType[idx].Unit,
+		flat:       make(map[string]int64),
+		cum:        make(map[string]int64),
+		calls:      make(map[[2]string]int64),
+	}
+	unmapped := make(map[string]bool)
+	for _, s := range p.Sample {
+		v := s.Value[idx]
+		if v == 0 {
+			continue
+		}
+		d.total += v
+
+		// frames from leaf to root, including inlined functions
+		var frames []string
+		for _, loc := range s.Location {
+			for _, l := range loc.Line {
+				if l.Function == nil {
+					continue
+				}
+				fn, ok := names[l.Function.Name]
+				if !ok {
+					unmapped[l.Function.Name] = true
+					fn = ""
+				}
+				frames = append(frames, fn)
+			}
+		}
+		if len(frames) == 0 {
+			continue
+		}
+		if frames[0] != "" {
+			d.flat[frames[0]] += v
+		}
+		seen := make(map[string]bool)
+		seenCalls := make(map[[2]string]bool)
+		for i, fn := range frames {
+			if fn != "" && !seen[fn] {
+				seen[fn] = true
+				d.cum[fn] += v
+			}
+			if i+1 < len(frames) && fn != "" && frames[i+1] != "" {
+				call := [2]string{frames[i+1], fn}
+				if !seenCalls[call] {
+					seenCalls[call] = true
+					d.calls[call] += v
+				}
+			}
+		}
+	}
+	d.unmapped = len(unmapped)
+	return d
+}
+
+// pprofName returns the symbol name of fn as found in profiles, e.g.
+// main.(*T).m, example.com/pkg%2ev2.f.func1 or main.Map[...] for all
+// instantiations of a generic function, or "" for synthetic functions and
+// the bodies of generic functions.
+func pprofName(fn *ssa.Function) string {
+	pkg := funcPkg(fn)
+	if isSyntheticFunc(fn) || pkg == nil {
+		return ""
+	}
+	if parent := fn.Parent(); parent != nil {
+		// closures are numbered funcN in their declaring function and N
+		// in other closures, where SSA uses $N
+		name := pprofName(parent)
+		if name == "" {
+			return ""
+		}
+		i := strings.LastIndex(fn.Name(), "$")
+		if parent.Parent() == nil {
+			return fmt.Sprintf("%s.func%s", name, fn.Name()[i+1:])
+		}
+		return fmt.Sprintf("%s.%s", name, fn.Name()[i+1:])
+	}
+	if isGenericBody(fn) {
+		return ""
+	}
+
+	// the linker escapes dots in the last element of the import path
+	path := pkg.Path()
+	if pkg.Name() == "main" {
+		path = "main"
+	} else if i := strings.LastIndex(path, "/"); i >= 0 {
+		path = path[:i] + strings.Replace(path[i:], ".", "%2e", -1)
+	} else {
+		path = strings.Replace(path, ".", "%2e", -1)
+	}
+
+	// instantiations share the symbol of their generic function
+	name := fn.Name()
+	if o := fn.Origin(); o != nil {
+		name = o.Name()
+		if o.Signature.TypeParams().Len() > 0 {
+			name += "[...]"
+		}
+	}
+
+	if recv := fn.Signature.Recv(); recv != nil {
+		t := namedType(recv.Type())
+		if t == nil {
+			return ""
+		}
+		typ := t.Name()
+		if fn.Origin() != nil && fn.Origin().Signature.RecvTypeParams().Len() > 0 {
+			typ += "[...]"
+		}
+		if _, ok := recv.Type().(*types.Pointer); ok {
+			return fmt.Sprintf("%s.(*%s).%s", path, typ, name)
+		}
+		return fmt.Sprintf("%s.%s.%s", path, typ, name)
+	}
+	return fmt.Sprintf("%s.%s", path, name)
+}
+
+// cost returns the cumulative cost of fn, 0 if d is nil.
+func (d *pprofData) cost(fn *ssa.Function) int64 {
+	if d == nil {
+		return 0
+	}
+	return d.cum[fn.String()]
+}
+
+// format returns v in the unit of the profile, e.g. 1.2s or 3.4MB.
+func (d *pprofData) format(v int64) string {
+	switch d.unit {
+	case "nanoseconds":
+		return time.Duration(v).Round(time.Microsecond).String()
+	case "bytes":
+		units := []string{"B", "kB", "MB", "GB", "TB"}
+		f, i := float64(v), 0
+		for ; f >= 1024 && i < len(units)-1; i++ {
+			f /= 1024
+		}
+		return fmt.Sprintf("%.3g%s", f, units[i])
+	}
+	return fmt.Sprint(v)
+}
+
+// percent returns v as a percentage of the total of the profile.
+func (d *pprofData) percent(v int64) float64 {
+	if d.total == 0 {
+		return 0
+	}
+	return 100 * float64(v) / float64(d.total)
+}
+
+// heatColor returns a fill color for the share of a function in the total
+// of a profile, from pale yellow for 0% over orange to red for 100%.
+// Shares are scaled by a square root to tell the colder functions apart.
+func heatColor(share float64) string {
+	stops := [][3]float64{
+		{0xff, 0xf5, 0xd6},
+		{0xfd, 0xae, 0x61},
+		{0xd7, 0x30, 0x27},
+	}
+	t := math.Sqrt(math.Max(0, math.Min(1, share)))
+	from, to := stops[0], stops[1]
+	if t > 0.5 {
+		from, to = stops[1], stops[2]
+		t -= 0.5
+	}
+	t *= 2
+	var rgb [3]int
+	for i := range rgb {
+		rgb[i] = int(from[i] + (to[i]-from[i])*t + 0.5)
+	}
+	return fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2])
+}
+
+// sortCalls sorts calls by caller and callee.
+func sortCalls(calls [][2]string) {
+	sort.Slice(calls, func(i, j int) bool {
+		return calls[i][0] < calls[j][0] || calls[i][0] == calls[j][0] && calls[i][1] < calls[j][1]
+	})
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"go/scanner"
+	"go/token"
+	"html"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// sourceFiles returns the source files of prog, the only files served by
+// the source viewer.
+func sourceFiles(prog *ssa.Program) map[string]bool {
+	files := make(map[string]bool)
+	prog.Fset.Iterate(func(f *token.File) bool {
+		files[f.Name()] = true
+		return true
+	})
+	return files
+}
+
+// viewerURL returns the URL of line of file in the source viewer.
+func viewerURL(file string, line int) string {
+	q := url.Values{}
+	q.Set("file", file)
+	q.Set("line", strconv.Itoa(line))
+	return "/source?" + q.Encode() + "#L" + strconv.Itoa(line)
+}
+
+// templateURL returns the URL of line of file expanding tmpl, where {file}
+// is replaced by the absolute path of file, {relfile} by its path relative
+// to the working directory and {line} by line, e.g.
+// vscode://file{file}:{line} or https://git.example.com/repo/blob/main/{relfile}#L{line}.
+func templateURL(tmpl, file string, line int) string {
+	rel := file
+	if wd, err := os.Getwd(); err == nil {
+		if r, err := filepath.Rel(wd, file); err == nil && !strings.HasPrefix(r, "..") {
+			rel = r
+		}
+	}
+	return strings.NewReplacer(
+		"{file}", filepath.ToSlash(file),
+		"{relfile}", filepath.ToSlash(rel),
+		"{line}", strconv.Itoa(line),
+	).Replace(tmpl)
+}
+
+// linkSources sets the URL of the nodes of g to their declaration and of
+// the edges to their first call site, keeping the URLs already set.
+// urlFor returns "" for positions not to link.
+func linkSources(g *dotGraph, urlFor func(file string, line int) string) {
+	g.visitNodes(func(n *dotNode, _ *dotCluster) {
+		if n.Attrs["URL"] != "" || n.Info == nil || n.Info.File == "" || n.Info.Line == 0 {
+			return
+		}
+		if u := urlFor(n.Info.File, n.Info.Line); u != "" {
+			n.Attrs["URL"] = u
+		}
+	})
+	for _, e := range g.Edges {
+		if e.Attrs["URL"] != "" || e.Info == nil || len(e.Info.Positions) == 0 {
+			continue
+		}
+		pos := e.Info.Positions[0]
+		i := strings.LastIndex(pos, ":")
+		if i < 0 {
+			continue
+		}
+		line, err := strconv.Atoi(pos[i+1:])
+		if err != nil {
+			continue
+		}
+		if u := urlFor(pos[:i], line); u != "" {
+			e.Attrs["URL"] = u
+		}
+	}
+}
+
+type sourceLine struct {
+	N    int
+	HTML template.HTML
+	Hl   bool
+}
+
+var sourceTmpl = template.Must(template.New("source").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Base}}:{{.Line}}</title>
+<style>
+body { margin: 0; font: 13px/1.45 monospace; }
+h1 { position: sticky; top: 0; margin: 0; padding: 8px 12px; background: #eee; font: bold 14px sans-serif; }
+pre { margin: 0; padding: 4px 0; }
+.l { display: block; padding-right: 12px; }
+.l:target, .hl { background: #fff3b0; }
+.ln { display: inline-block; width: 5em; padding-right: 1em; color: #999; text-align: right; text-decoration: none; user-select: none; }
+.k { color: #a626a4; font-weight: bold; }
+.c { color: #8a8a8a; font-style: italic; }
+.s { color: #50a14f; }
+.d { color: #986801; }
+</style>
+</head>
+<body>
+<h1>{{.File}}</h1>
+<pre>{{range .Lines}}<span class="l{{if .Hl}} hl{{end}}" id="L{{.N}}"><a class="ln" href="#L{{.N}}">{{.N}}</a>{{.HTML}}</span>{{end}}</pre>
+</body>
+</html>
+`))
+
+// sourceHandler serves /source?file=&line=, showing a source file of the
+// analyzed program with the given line highlighted.
+func sourceHandler(w http.ResponseWriter, r *http.Request) {
+	file := r.FormValue("file")
+	if !Analysis.sources[file] {
+		http.NotFound(w, r)
+		return
+	}
+	line, _ := strconv.Atoi(r.FormValue("line"))
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var lines []sourceLine
+	for i, l := range highlightGo(src) {
+		lines = append(lines, sourceLine{N: i + 1, HTML: l, Hl: i+1 == line})
+	}
+	var buf bytes.Buffer
+	err = sourceTmpl.Execute(&buf, map[string]interface{}{
+		"File":  file,
+		"Base":  filepath.Base(file),
+		"Line":  line,
+		"Lines": lines,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := buf.WriteTo(w); err != nil {
+		log.Printf("writing source: %v", err)
+	}
+}
+
+// highlightGo returns the lines of the Go source src as HTML, wrapping
+// keywords, comments, strings and numbers in spans of the classes k, c, s
+// and d. Other sources are returned escaped.
+func highlightGo(src []byte) []template.HTML {
+	class := make([]byte, len(src))
+	fset := token.NewFileSet()
+	f := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	s.Init(f, src, nil, scanner.ScanComments)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		start := f.Offset(pos)
+		end := start + len(lit)
+		var c byte
+		switch {
+		case tok == token.COMMENT:
+			// the literal of comments and raw strings lacks carriage returns
+			c, end = 'c', commentEnd(src, start)
+		case tok == token.STRING && src[start] == '`':
+			c, end = 's', start+1+bytes.IndexByte(src[start+1:], '`')+1
+		case tok == token.STRING || tok == token.CHAR:
+			c = 's'
+		case tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+			c = 'd'
+		case tok.IsKeyword():
+			c, end = 'k', start+len(tok.String())
+		default:
+			continue
+		}
+		if end <= start || end > len(src) {
+			end = len(src)
+		}
+		for i := start; i < end; i++ {
+			class[i] = c
+		}
+	}
+
+	var lines []template.HTML
+	for start := 0; start <= len(src); {
+		end := bytes.IndexByte(src[start:], '\n')
+		if end < 0 {
+			end = len(src)
+			if start == end {
+				break
+			}
+		} else {
+			end += start
+		}
+		var b strings.Builder
+		for i := start; i < end; {
+			j := i
+			for j < end && class[j] == class[i] {
+				j++
+			}
+			text := html.EscapeString(strings.TrimRight(string(src[i:j]), "\r"))
+			if class[i] != 0 {
+				b.WriteString(`<span class="` + string(class[i]) + `">` + text + `</span>`)
+			} else {
+				b.WriteString(text)
+			}
+			i = j
+		}
+		lines = append(lines, template.HTML(b.String()))
+		start = end + 1
+	}
+	return lines
+}
+
+// commentEnd returns the offset after the comment starting at start.
+func commentEnd(src []byte, start int) int {
+	if bytes.HasPrefix(src[start:], []byte("/*")) {
+		if i := bytes.Index(src[start+2:], []byte("*/")); i >= 0 {
+			return start + 2 + i + 2
+		}
+		return len(src)
+	}
+	if i := bytes.IndexByte(src[start:], '\n'); i >= 0 {
+		return start + i
+	}
+	return len(src)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
+)
+
+// testKinds are the prefixes of the functions run by go test by the type of
+// their parameter, "" for examples which take none.
+var testKinds = map[string]string{
+	"Test":      "T",
+	"Benchmark": "B",
+	"Fuzz":      "F",
+	"Example":   "",
+}
+
+// isTestName reports whether name is prefix followed by nothing or by a
+// character other than a lower case letter, as go test requires.
+func isTestName(name, prefix string) bool {
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	if len(name) == len(prefix) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(name[len(prefix):])
+	return !unicode.IsLower(r)
+}
+
+// isTestFunc reports whether fn is a test, benchmark, fuzz test or example
+// declared in a _test.go file.
+func isTestFunc(prog *ssa.Program, fn *ssa.Function) bool {
+	if fn.Signature.Recv() != nil || fn.Signature.Results().Len() != 0 ||
+		!strings.HasSuffix(prog.Fset.Position(fn.Pos()).Filename, "_test.go") {
+		return false
+	}
+	params := fn.Signature.Params()
+	for prefix, arg := range testKinds {
+		if !isTestName(fn.Name(), prefix) {
+			continue
+		}
+		if arg == "" {
+			return params.Len() == 0
+		}
+		if params.Len() != 1 {
+			return false
+		}
+		ptr, ok := params.At(0).Type().(*types.Pointer)
+		if !ok {
+			return false
+		}
+		named, ok := ptr.Elem().(*types.Named)
+		return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "testing" &&
+			named.Obj().Name() == arg
+	}
+	return false
+}
+
+// testRoots returns the tests, benchmarks, fuzz tests and examples of pkgs
+// whose name matches the regular expression run, all of them if run is
+// empty.
+func testRoots(prog *ssa.Program, pkgs []*ssa.Package, run string) ([]*ssa.Function, error) {
+	re, err := regexp.Compile(run)
+	if err != nil {
+		return nil, fmt.Errorf("invalid test-run option: %v", err)
+	}
+	var roots []*ssa.Function
+	for _, p := range pkgs {
+		if p == nil {
+			continue
+		}
+		for _, m := range p.Members {
+			if fn, ok := m.(*ssa.Function); ok && isTestFunc(prog, fn) && re.MatchString(fn.Name()) {
+				roots = append(roots, fn)
+			}
+		}
+	}
+	if len(roots) == 0 {
+		if run != "" {
+			return nil, fmt.Errorf("no tests matching %q", run)
+		}
+		return nil, fmt.Errorf("no tests")
+	}
+	sort.Slice(roots, func(i, j int) bool { return roots[i].String() < roots[j].String() })
+	return roots, nil
+}
+
+// testReach returns the names of the functions reachable from roots in cg
+// whose calls are drawn. The calls of the testing package are not followed, as it runs
+// all tests, subtests run by t.Run are reached as closures of the test.
+func testReach(cg *callgraph.Graph, roots []*ssa.Function) map[string]bool {
+	reach := make(map[string]bool)
+	var visit func(fn *ssa.Function)
+	visit = func(fn *ssa.Function) {
+		if reach[fn.String()] {
+			return
+		}
+		if pkg := funcPkg(fn); pkg != nil && pkg.Path() == "testing" {
+			return
+		}
+		reach[fn.String()] = true
+		for _, anon := range fn.AnonFuncs {
+			visit(anon)
+		}
+		if n := cg.Nodes[fn]; n != nil {
+			for _, e := range n.Out {
+				visit(e.Callee.Func)
+			}
+		}
+	}
+	for _, fn := range roots {
+		visit(fn)
+	}
+	return reach
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/google/pprof/profile"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// callTrace holds the calls observed at runtime, by the
+// ssa.Function.String() of caller and callee.
+type callTrace struct {
+	calls    map[[2]string]bool
+	unmapped int // traced functions not in the program
+}
+
+// readCallTrace reads the calls observed at runtime from path, either a
+// profile in pprof format, e.g. written by go tool trace -pprof=sched, or
+// a log with a caller and a callee per line:
+//
+//	# comment
+//	main.main -> main.(*T).m
+//	main.(*T).m main.f.func1
+//
+// Functions are named as by runtime.FuncForPC or ssa.Function.String().
+func readCallTrace(prog *ssa.Program, path string) (*callTrace, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading call trace: %v", err)
+	}
+	names := pprofNames(prog)
+	t := &callTrace{calls: make(map[[2]string]bool)}
+
+	if p, err := profile.Parse(bytes.NewReader(data)); err == nil {
+		d := newPprofData(p, names)
+		for call := range d.calls {
+			t.calls[call] = true
+		}
+		t.unmapped = d.unmapped
+		return t, nil
+	}
+
+	for fn := range ssautil.AllFunctions(prog) {
+		names[fn.String()] = fn.String()
+	}
+	unmapped := make(map[string]bool)
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var fields []string
+		for _, f := range strings.Fields(line) {
+			if f != "->" {
+				fields = append(fields, f)
+			}
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("reading call trace %s:%d: expected caller and callee, got %q", path, n, line)
+		}
+		var call [2]string
+		for i, f := range fields {
+			fn, ok := names[f]
+			if !ok {
+				unmapped[f] = true
+			}
+			call[i] = fn
+		}
+		if call[0] != "" && call[1] != "" {
+			t.calls[call] = true
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("reading call trace %s: %v", path, err)
+	}
+	t.unmapped = len(unmapped)
+	return t, nil
+}